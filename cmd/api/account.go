@@ -0,0 +1,371 @@
+package main
+
+import (
+	"errors"
+	"github.com/hayohtee/greenlight/internal/data"
+	"github.com/hayohtee/greenlight/internal/validator"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (app *application) showCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Read the user from the database, as the one in the request context only has its
+	// ID when authenticated with a signed token.
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"user": user}
+
+	deleteAt, err := app.models.Users.GetDeletion(user.ID)
+	switch {
+	case err == nil:
+		env["deletion_scheduled_at"] = deleteAt
+	case !errors.Is(err, data.ErrRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateCurrentUserHandler updates the name or the password of the authenticated user.
+// Changing the password requires the current one, which is subject to the same delays
+// and lockouts as logins, and logs the user out of their other sessions.
+func (app *application) updateCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name            *string `json:"name"`
+		Password        *string `json:"password"`
+		CurrentPassword *string `json:"current_password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+
+	if input.Password != nil {
+		v.Check(input.CurrentPassword != nil && *input.CurrentPassword != "", "current_password", "must be provided to change the password")
+
+		if input.CurrentPassword != nil && *input.CurrentPassword != "" {
+			match, retryAfter, err := app.verifyPassword(r, user, *input.CurrentPassword)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			if retryAfter > 0 {
+				app.loginThrottledResponse(w, r, retryAfter)
+				return
+			}
+
+			v.Check(match, "current_password", "is incorrect")
+		}
+
+		err = app.validatePasswordPolicy(v, *input.Password, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = user.Password.Set(*input.Password)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if data.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if input.Password != nil {
+		err = app.revokeOtherSessions(user.ID, app.contextGetSession(r))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCurrentUserHandler schedules the deletion of the authenticated user once the
+// grace period has passed, and logs them out everywhere. It requires their password,
+// which is subject to the same delays and lockouts as logins. Their API keys and OAuth
+// clients stop working in the meantime, as the lookups ignore the users whose deletion
+// is scheduled. Logging in again and cancelling the deletion keeps the account.
+func (app *application) deleteCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Password != "", "password", "must be provided")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	match, retryAfter, err := app.verifyPassword(r, user, input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if retryAfter > 0 {
+		app.loginThrottledResponse(w, r, retryAfter)
+		return
+	}
+
+	if !match {
+		v.AddError("password", "is incorrect")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	deleteAt, err := app.models.Users.ScheduleDeletion(user.ID, time.Now().Add(app.config.users.deletionGracePeriod))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.revokeAllSessions(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		templateData := map[string]any{
+			"deleteAt": deleteAt.UTC().Format(time.RFC1123),
+		}
+
+		err := app.mailer.Send(user.Email, "account_deletion.tmpl", templateData)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	env := envelope{
+		"message":               "your account will be deleted at the end of the grace period, unless you cancel it",
+		"deletion_scheduled_at": deleteAt,
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) cancelUserDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Users.CancelDeletion(app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "account deletion successfully cancelled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// exportCurrentUserHandler sends a JSON archive of everything held about the
+// authenticated user. Secrets, such as password hashes and webhook secrets, are left
+// out.
+func (app *application) exportCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID := app.contextGetUser(r).ID
+
+	user, err := app.models.Users.Get(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	export := envelope{
+		"exported_at": time.Now(),
+		"user":        user,
+	}
+
+	// Read each part of the export, stopping at the first error.
+	steps := []struct {
+		key  string
+		read func() (any, error)
+	}{
+		{"roles", func() (any, error) { return app.models.Roles.GetAllForUser(userID) }},
+		{"permissions", func() (any, error) { return app.models.Permissions.GetAllForUser(userID) }},
+		{"sessions", func() (any, error) { return app.models.Tokens.GetSessionsForUser(userID) }},
+		{"api_keys", func() (any, error) { return app.models.APIKeys.GetAllForUser(userID) }},
+		{"oauth_clients", func() (any, error) { return app.models.OAuth.GetClientsForUser(userID) }},
+		{"oauth_consents", func() (any, error) { return app.models.OAuth.GetConsentsForUser(userID) }},
+		{"identities", func() (any, error) { return app.models.OIDC.GetIdentitiesForUser(userID) }},
+		{"lists", func() (any, error) { return app.exportLists(userID) }},
+		{"webhooks", func() (any, error) { return app.exportWebhooks(userID) }},
+		{"two_factor_enabled", func() (any, error) {
+			twoFactor, err := app.models.TwoFactor.Get(userID)
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return false, nil
+			}
+			return err == nil && twoFactor.Enabled(), err
+		}},
+		{"pending_email", func() (any, error) {
+			email, err := app.models.Users.GetPendingEmail(userID)
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return nil, nil
+			}
+			return email, err
+		}},
+		{"deletion_scheduled_at", func() (any, error) {
+			deleteAt, err := app.models.Users.GetDeletion(userID)
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return nil, nil
+			}
+			return deleteAt, err
+		}},
+	}
+
+	for _, step := range steps {
+		value, err := step.read()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		export[step.key] = value
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Disposition", `attachment; filename="greenlight-export.json"`)
+
+	err = app.writeJSON(w, http.StatusOK, export, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// exportFilters returns the filters to read every page of the records of a user.
+func exportFilters() data.Filters {
+	return data.Filters{Page: 1, PageSize: 100, Sort: "id", SortSafeList: []string{"id"}}
+}
+
+// exportLists returns every list of the user, along with their items.
+func (app *application) exportLists(userID int64) ([]*data.List, error) {
+	lists := []*data.List{}
+
+	for filters := exportFilters(); ; filters.Page++ {
+		page, metadata, err := app.models.Lists.GetAllForUser(userID, filters)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, page...)
+
+		if filters.Page >= metadata.LastPage {
+			break
+		}
+	}
+
+	for _, list := range lists {
+		items, err := app.models.Lists.GetItems(list.ID)
+		if err != nil {
+			return nil, err
+		}
+		list.Items = items
+	}
+
+	return lists, nil
+}
+
+// exportWebhooks returns every webhook of the user, without their secrets.
+func (app *application) exportWebhooks(userID int64) ([]*data.Webhook, error) {
+	webhooks := []*data.Webhook{}
+
+	for filters := exportFilters(); ; filters.Page++ {
+		page, metadata, err := app.models.Webhooks.GetAllForUser(userID, filters)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, page...)
+
+		if filters.Page >= metadata.LastPage {
+			break
+		}
+	}
+
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+	}
+
+	return webhooks, nil
+}
+
+// deleteUsersPeriodically launches a background goroutine which deletes the users due
+// for deletion once every deletion interval.
+func (app *application) deleteUsersPeriodically() {
+	if app.config.users.deletionInterval <= 0 {
+		return
+	}
+
+	app.periodically(app.config.users.deletionInterval, func() {
+		deleted, err := app.models.Users.DeleteScheduled()
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"task": "delete users"})
+			return
+		}
+
+		if deleted > 0 {
+			app.logger.PrintInfo("deleted users", map[string]string{"count": strconv.FormatInt(deleted, 10)})
+		}
+	})
+}
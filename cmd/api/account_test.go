@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hayohtee/greenlight/internal/data"
+)
+
+// sendAsUser sends the JSON body to the handler from the address, authenticated as the
+// user.
+func sendAsUser(t *testing.T, app *application, handler http.HandlerFunc, method string, user *data.User, ip string, body map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	js, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(method, "/v1/users/me", bytes.NewReader(js))
+	r.RemoteAddr = ip + ":4321"
+	r = app.contextSetup(r, &data.User{ID: user.ID, Activated: true})
+
+	rr := httptest.NewRecorder()
+	handler(rr, r)
+	return rr
+}
+
+func TestAccountPasswordChecksThrottled(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(app *application) http.HandlerFunc
+		method  string
+		body    func(t *testing.T, app *application, password string) map[string]string
+	}{
+		{
+			name:    "update",
+			handler: func(app *application) http.HandlerFunc { return app.updateCurrentUserHandler },
+			method:  http.MethodPatch,
+			body: func(t *testing.T, app *application, password string) map[string]string {
+				return map[string]string{"password": "x8#Lq2!vZr9@kW", "current_password": password}
+			},
+		},
+		{
+			name:    "email",
+			handler: func(app *application) http.HandlerFunc { return app.updateUserEmailHandler },
+			method:  http.MethodPatch,
+			body: func(t *testing.T, app *application, password string) map[string]string {
+				return map[string]string{"email": uniqueEmail(t, app), "password": password}
+			},
+		},
+		{
+			name:    "delete",
+			handler: func(app *application) http.HandlerFunc { return app.deleteCurrentUserHandler },
+			method:  http.MethodDelete,
+			body: func(t *testing.T, app *application, password string) map[string]string {
+				return map[string]string{"password": password}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.login.lockoutThreshold = 1
+
+			user := insertTestUser(t, app, "pa55word1234")
+			ip := uniqueIP(t, app)
+
+			rr := sendAsUser(t, app, tt.handler(app), tt.method, user, ip, tt.body(t, app, "wrong-password"))
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("got status %d; want %d: %s", rr.Code, http.StatusUnprocessableEntity, rr.Body)
+			}
+
+			// The wrong password locked the account out, as a failed login would have.
+			rr = sendAsUser(t, app, tt.handler(app), tt.method, user, ip, tt.body(t, app, "pa55word1234"))
+			if rr.Code != http.StatusTooManyRequests {
+				t.Fatalf("got status %d; want %d: %s", rr.Code, http.StatusTooManyRequests, rr.Body)
+			}
+
+			rr = login(t, app, user.Email, "pa55word1234", ip+":4321", nil)
+			if rr.Code != http.StatusTooManyRequests {
+				t.Errorf("got login status %d; want %d: %s", rr.Code, http.StatusTooManyRequests, rr.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"errors"
+	"github.com/hayohtee/greenlight/internal/data"
+	"github.com/hayohtee/greenlight/internal/validator"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"time"
+)
+
+func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Search        string
+		Activated     *bool
+		CreatedAfter  *time.Time
+		CreatedBefore *time.Time
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Search = app.readString(qs, "q", "")
+	input.Activated = app.readBool(qs, "activated", v)
+	input.CreatedAfter = app.readTime(qs, "created_after", v)
+	input.CreatedBefore = app.readTime(qs, "created_before", v)
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Sort = app.readString(qs, "sort", "id")
+	input.SortSafeList = []string{"id", "name", "email", "created_at", "-id", "-name", "-email", "-created_at"}
+
+	v.Check(len(input.Search) <= 500, "q", "must not be more than 500 bytes long")
+
+	if input.CreatedAfter != nil && input.CreatedBefore != nil {
+		v.Check(input.CreatedAfter.Before(*input.CreatedBefore), "created_before", "must be after created_after")
+	}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	users, metadata, err := app.models.Users.GetAll(input.Search, input.Activated, input.CreatedAfter, input.CreatedBefore, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"users": users, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readAdministeredUser(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeUserAccess(w, r, user, envelope{"user": user})
+}
+
+// deactivateUserHandler deactivates the account of a user, which logs them out
+// everywhere and stops them from logging in until they are reactivated.
+func (app *application) deactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readAdministeredUser(w, r)
+	if !ok {
+		return
+	}
+
+	if user.ID == app.contextGetUser(r).ID {
+		app.badRequestResponse(w, r, errors.New("you can't deactivate your own account"))
+		return
+	}
+
+	app.setUserDeactivated(w, r, user, true)
+}
+
+func (app *application) reactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readAdministeredUser(w, r)
+	if !ok {
+		return
+	}
+
+	app.setUserDeactivated(w, r, user, false)
+}
+
+// setUserDeactivated updates whether the user is deactivated, revoking their sessions
+// when they are, and sends the user.
+func (app *application) setUserDeactivated(w http.ResponseWriter, r *http.Request, user *data.User, deactivated bool) {
+	if user.Deactivated != deactivated {
+		user.Deactivated = deactivated
+
+		err := app.models.Users.Update(user)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				app.editConflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	// The sessions are revoked even if the user was already deactivated, in case a
+	// previous attempt failed after the update.
+	if deactivated {
+		err := app.revokeAllSessions(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// logoutUserHandler revokes every session of a user, logging them out everywhere.
+func (app *application) logoutUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readAdministeredUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.revokeAllSessions(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "user successfully logged out of every session"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) grantUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readAdministeredUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	known, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.Permissions) > 0, "permissions", "must contain at least one permission")
+	v.Check(validator.Unique(input.Permissions), "permissions", "must not contain duplicate values")
+	for _, code := range input.Permissions {
+		v.Check(known.Include(code), "permissions", "must only contain existing permissions")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Permissions.AddForUser(user.ID, input.Permissions...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeUserAccess(w, r, user, envelope{})
+}
+
+// revokeUserPermissionHandler revokes a permission granted directly to a user. The
+// permissions they get through their roles can only be revoked by taking the role away.
+func (app *application) revokeUserPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readAdministeredUser(w, r)
+	if !ok {
+		return
+	}
+
+	code := httprouter.ParamsFromContext(r.Context()).ByName("code")
+
+	// Administrators can't give up the permission themselves, so that there is always
+	// someone left to administer the users.
+	if code == "users:admin" && user.ID == app.contextGetUser(r).ID {
+		app.badRequestResponse(w, r, errors.New("you can't revoke your own administration permission"))
+		return
+	}
+
+	err := app.models.Permissions.RemoveForUser(user.ID, code)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeUserAccess(w, r, user, envelope{})
+}
+
+func (app *application) grantUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readAdministeredUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Roles []string `json:"roles"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	roles, err := app.models.Roles.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	known := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		known[role.Name] = true
+	}
+
+	v := validator.New()
+	v.Check(len(input.Roles) > 0, "roles", "must contain at least one role")
+	v.Check(validator.Unique(input.Roles), "roles", "must not contain duplicate values")
+	for _, name := range input.Roles {
+		v.Check(known[name], "roles", "must only contain existing roles")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Roles.AddForUser(user.ID, input.Roles...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeUserAccess(w, r, user, envelope{})
+}
+
+func (app *application) revokeUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readAdministeredUser(w, r)
+	if !ok {
+		return
+	}
+
+	name := httprouter.ParamsFromContext(r.Context()).ByName("role")
+
+	// As for the permission itself, administrators can't take away from themselves a
+	// role which lets them administer the users.
+	if user.ID == app.contextGetUser(r).ID {
+		role, err := app.models.Roles.GetByName(name)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if role != nil && role.Permissions.Include("users:admin") {
+			app.badRequestResponse(w, r, errors.New("you can't revoke your own administration role"))
+			return
+		}
+	}
+
+	err := app.models.Roles.RemoveForUser(user.ID, name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeUserAccess(w, r, user, envelope{})
+}
+
+// writeUserAccess sends the roles and the effective permissions of the user, added to
+// the given envelope.
+func (app *application) writeUserAccess(w http.ResponseWriter, r *http.Request, user *data.User, env envelope) {
+	roles, err := app.models.Roles.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env["roles"] = roles
+	env["permissions"] = permissions
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// unlockUserHandler lifts the lockout of the account of a user after failed logins,
+// and forgets the failures.
+func (app *application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readAdministeredUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.LoginFailures.Reset(data.LoginFailureAccount, data.AccountKey(user.Email))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "account successfully unlocked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readAdministeredUser fetches the user identified by the "id" URL parameter. If it
+// doesn't exist, or anything else goes wrong, an error response is sent to the client
+// and false is returned.
+func (app *application) readAdministeredUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	user, err := app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
@@ -2,10 +2,17 @@ package main
 
 import (
 	"github.com/hayohtee/greenlight/internal/data"
+	"github.com/hayohtee/greenlight/internal/encryption"
 	"github.com/hayohtee/greenlight/internal/jsonlog"
+	"github.com/hayohtee/greenlight/internal/jwt"
 	"github.com/hayohtee/greenlight/internal/mailer"
+	"github.com/hayohtee/greenlight/internal/oidc"
+	"github.com/hayohtee/greenlight/internal/passwords"
 	"github.com/hayohtee/greenlight/internal/vcs"
+	"github.com/hayohtee/greenlight/internal/webhook"
+	"net/netip"
 	"sync"
+	"time"
 )
 
 // Holds the application version number.
@@ -33,6 +40,41 @@ type config struct {
 		burst   int
 		enabled bool
 	}
+	proxies struct {
+		// Holds the addresses of the reverse proxies in front of the server. The
+		// client address is only read from the X-Forwarded-For and X-Real-Ip headers
+		// of the requests they send, since anyone else can set them to anything.
+		trusted []netip.Prefix
+	}
+	users struct {
+		// Holds how long after asking for it a user is deleted, during which they
+		// can cancel the deletion.
+		deletionGracePeriod time.Duration
+		// Holds how often the users due for deletion are deleted.
+		deletionInterval time.Duration
+		// Holds the name of the role given to new users, none if empty.
+		defaultRole string
+	}
+	password struct {
+		// Holds the minimum estimated strength of passwords in bits.
+		minEntropy float64
+		// Holds the path of the breached passwords file, passwords aren't screened
+		// without it.
+		breachedCorpus string
+	}
+	login struct {
+		// Holds the number of failed logins for an account after which a delay,
+		// doubling with every failure up to maxDelay, is required between attempts.
+		delayThreshold int
+		maxDelay       time.Duration
+		// Holds the number of failed logins after which an account, or a client IP
+		// address, is locked out for lockoutDuration.
+		lockoutThreshold   int
+		ipLockoutThreshold int
+		lockoutDuration    time.Duration
+		// Holds how long failed logins are counted for.
+		failureWindow time.Duration
+	}
 	smtp struct {
 		host     string
 		port     int
@@ -40,17 +82,118 @@ type config struct {
 		password string
 		sender   string
 	}
+	compression struct {
+		enabled bool
+		// Holds the size under which response bodies are sent uncompressed.
+		minSize int
+	}
+	cache struct {
+		// Holds the Cache-Control header sent with cacheable movie responses.
+		control string
+	}
+	movieCache struct {
+		enabled bool
+		// Holds the maximum number of movies cached.
+		size int
+		// Holds how long a movie is cached for.
+		ttl time.Duration
+	}
+	permissionCache struct {
+		enabled bool
+		// Holds the maximum number of users whose permissions are cached.
+		size int
+		// Holds how long the permissions of a user are cached for.
+		ttl time.Duration
+	}
+	tokens struct {
+		// Holds how long authentication tokens are valid for.
+		authenticationTTL time.Duration
+		// Holds how long refresh tokens are valid for.
+		refreshTTL time.Duration
+		// Holds the kind of authentication tokens issued (database|signed).
+		mode string
+		// Holds the keys signed tokens are signed and verified with, as space
+		// separated "kid:secret" pairs. The first key signs new tokens.
+		signingKeys string
+		// Holds how often the revoked signed tokens are reloaded from the database.
+		revocationSyncInterval time.Duration
+	}
+	oauth struct {
+		// Holds the public URL of the server, which identifies it as an OAuth
+		// authorization server.
+		issuer string
+	}
+	oidc struct {
+		// Holds the issuer URL of the external OpenID Connect provider, logging in
+		// with the provider is unavailable without it.
+		issuer       string
+		clientID     string
+		clientSecret string
+		// Holds the URI of the frontend page the provider redirects users to, which
+		// sends the code and state it receives to POST /v1/tokens/oidc.
+		redirectURI string
+	}
+	twoFactor struct {
+		// Holds the base64 encoded 32 bytes key the TOTP secrets are encrypted with.
+		encryptionKey string
+		// Holds the issuer name shown by authenticator apps.
+		issuer string
+		// Holds the permission codes which can only be used by the users who have
+		// enabled two-factor authentication.
+		requiredPermissions []string
+	}
+	activation struct {
+		// Holds the minimum time between two activation emails sent to a user.
+		resendCooldown time.Duration
+	}
 	cors struct {
 		trustedOrigins []string
 	}
+	stats struct {
+		// Holds how often the catalog statistics are recomputed.
+		refreshInterval time.Duration
+	}
+	webhooks struct {
+		// Holds how often the delivery queue is polled for due deliveries.
+		pollInterval time.Duration
+		// Holds the number of attempts after which a delivery is marked as failed.
+		maxAttempts int
+		// Holds the time to wait for a subscriber to respond.
+		timeout time.Duration
+	}
+	events struct {
+		// Holds the number of events buffered for each subscriber before it is
+		// considered too slow and disconnected.
+		bufferSize int
+		// Holds how long movie events are kept for clients resuming a stream.
+		retention time.Duration
+	}
+	openapi struct {
+		// Holds whether requests are validated against the OpenAPI document,
+		// which only applies in the development environment.
+		validate bool
+	}
 }
 
 // A type to hold the dependencies for HTTP handlers, helpers,
 // middlewares.
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config   config
+	logger   *jsonlog.Logger
+	models   data.Models
+	mailer   mailer.Mailer
+	webhooks webhook.Sender
+	events   *movieEventHub
+	// Holds the keys of the signed tokens, nil if no key was configured.
+	signingKeys *jwt.KeyRing
+	revocations *revocationList
+	// Holds the cipher of the TOTP secrets, nil if no key was configured.
+	twoFactorCipher *encryption.Cipher
+	// Holds the rules new passwords must follow.
+	passwordPolicy *passwords.Policy
+	// Holds the external OpenID Connect provider, nil if none was configured.
+	oidcProvider *oidc.Provider
+	// Closed when the server shuts down, to stop the periodic background tasks.
+	shutdown chan struct{}
+	wg       sync.WaitGroup
 }
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"expvar"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// compressor is the interface shared by gzip.Writer and zlib.Writer.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressorPools holds a pool of compressors for each supported content coding. The
+// "deflate" coding is the zlib format, as per RFC 9110.
+var compressorPools = map[string]*sync.Pool{
+	"gzip":    {New: func() any { return gzip.NewWriter(io.Discard) }},
+	"deflate": {New: func() any { return zlib.NewWriter(io.Discard) }},
+}
+
+// incompressibleTypes holds the media types, or their prefixes, of content which is
+// already compressed, plus the event stream which must be flushed as is.
+var incompressibleTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"text/event-stream",
+}
+
+// compressResponseWriter buffers the start of the response body until it has enough
+// bytes to decide whether compressing it is worthwhile, delaying the status code until
+// then. Once compression has started, the body is written through the compressor.
+type compressResponseWriter struct {
+	wrapped    http.ResponseWriter
+	encoding   string
+	minSize    int
+	buf        []byte
+	statusCode int
+	started    bool
+	compressor compressor
+	counter    *countingWriter
+	bytesIn    int64
+}
+
+func (cw *compressResponseWriter) Header() http.Header {
+	return cw.wrapped.Header()
+}
+
+func (cw *compressResponseWriter) WriteHeader(statusCode int) {
+	if cw.started || cw.statusCode != 0 {
+		return
+	}
+	cw.statusCode = statusCode
+}
+
+func (cw *compressResponseWriter) Write(b []byte) (int, error) {
+	if !cw.started {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.minSize {
+			return len(b), nil
+		}
+		if err := cw.start(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if cw.compressor != nil {
+		cw.bytesIn += int64(len(b))
+		return cw.compressor.Write(b)
+	}
+	return cw.wrapped.Write(b)
+}
+
+// Flush sends any buffered data to the client, which is needed for streamed responses.
+func (cw *compressResponseWriter) Flush() {
+	if !cw.started {
+		if err := cw.start(); err != nil {
+			return
+		}
+	}
+
+	if cw.compressor != nil {
+		if err := cw.compressor.Flush(); err != nil {
+			return
+		}
+	}
+
+	_ = http.NewResponseController(cw.wrapped).Flush()
+}
+
+func (cw *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.wrapped
+}
+
+// start writes the status code, deciding whether to compress the body from the size
+// of the buffered data and the content type, then writes the buffered data.
+func (cw *compressResponseWriter) start() error {
+	cw.started = true
+
+	if cw.statusCode == 0 {
+		cw.statusCode = http.StatusOK
+	}
+
+	h := cw.Header()
+
+	// Sniff the content type like net/http would, since it's needed to decide.
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	if len(cw.buf) > 0 && len(cw.buf) >= cw.minSize && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+
+		cw.counter = &countingWriter{wrapped: cw.wrapped}
+		cw.compressor = compressorPools[cw.encoding].Get().(compressor)
+		cw.compressor.Reset(cw.counter)
+	}
+
+	cw.wrapped.WriteHeader(cw.statusCode)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+
+	_, err := cw.Write(buf)
+	return err
+}
+
+// close writes out the rest of the response, and returns the number of bytes before
+// and after compression, or zeros if the response wasn't compressed.
+func (cw *compressResponseWriter) close() (int64, int64, error) {
+	if !cw.started {
+		if err := cw.start(); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if cw.compressor == nil {
+		return 0, 0, nil
+	}
+
+	err := cw.compressor.Close()
+	compressorPools[cw.encoding].Put(cw.compressor)
+	cw.compressor = nil
+
+	return cw.bytesIn, cw.counter.n, err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	wrapped io.Writer
+	n       int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.wrapped.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// compressible reports whether content of the media type benefits from compression.
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, t := range incompressibleTypes {
+		if strings.HasPrefix(mediaType, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// negotiateEncoding picks the content coding from the Accept-Encoding header, returning
+// an empty string if the response should not be compressed.
+func negotiateEncoding(acceptEncoding string) string {
+	var encoding string
+	var bestQ float64
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+
+		q := 1.0
+		if name, value, found := strings.Cut(strings.TrimSpace(params), "="); found && strings.TrimSpace(name) == "q" {
+			var err error
+			q, err = strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		// Prefer gzip over deflate when both are equally acceptable.
+		for _, candidate := range []string{"gzip", "deflate"} {
+			if coding != candidate && coding != "*" {
+				continue
+			}
+			if q > bestQ || (q == bestQ && candidate == "gzip" && encoding == "deflate") {
+				encoding, bestQ = candidate, q
+			}
+		}
+	}
+
+	return encoding
+}
+
+// compress is a middleware which compresses the response body with gzip or deflate
+// when the client accepts it, the body is large enough for compression to pay off and
+// its content isn't already compressed.
+func (app *application) compress(next http.Handler) http.Handler {
+	var (
+		totalCompressedResponses = expvar.NewMap("total_compressed_responses_by_encoding")
+		totalBytesUncompressed   = expvar.NewInt("total_compression_bytes_in")
+		totalBytesCompressed     = expvar.NewInt("total_compression_bytes_out")
+	)
+
+	// Publish the overall ratio of compressed to uncompressed bytes.
+	expvar.Publish("compression_ratio", expvar.Func(func() any {
+		in := totalBytesUncompressed.Value()
+		if in == 0 {
+			return 0.0
+		}
+		return float64(totalBytesCompressed.Value()) / float64(in)
+	}))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if !app.config.compression.enabled || encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressResponseWriter{
+			wrapped:  w,
+			encoding: encoding,
+			minSize:  app.config.compression.minSize,
+		}
+
+		next.ServeHTTP(cw, r)
+
+		in, out, err := cw.close()
+		if err != nil {
+			app.logError(r, err)
+			return
+		}
+
+		if out > 0 {
+			totalCompressedResponses.Add(encoding, 1)
+			totalBytesUncompressed.Add(in)
+			totalBytesCompressed.Add(out)
+		}
+	})
+}
@@ -12,6 +12,17 @@ type contextKey string
 // Represent a key for storing and retrieving user information in the context.
 const userContextKey = contextKey("user")
 
+// Represent a key for storing and retrieving the session of the authentication token
+// used by the request in the context.
+const sessionContextKey = contextKey("session")
+
+// Represent a key for storing and retrieving the API key used by the request in the context.
+const apiKeyContextKey = contextKey("api_key")
+
+// Represent a key for storing and retrieving the effective permissions of the user in
+// the context.
+const permissionsContextKey = contextKey("permissions")
+
 // contextSetup returns a new copy of the request with the provided User struct
 // added to the context.
 func (app *application) contextSetup(r *http.Request, user *data.User) *http.Request {
@@ -27,3 +38,45 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+// contextSetSession returns a new copy of the request with the provided Session
+// struct added to the context.
+func (app *application) contextSetSession(r *http.Request, session *data.Session) *http.Request {
+	ctx := context.WithValue(r.Context(), sessionContextKey, session)
+	return r.WithContext(ctx)
+}
+
+// contextGetSession retrieves the Session struct from the request context, or nil
+// if the request wasn't authenticated with an authentication token.
+func (app *application) contextGetSession(r *http.Request) *data.Session {
+	session, _ := r.Context().Value(sessionContextKey).(*data.Session)
+	return session
+}
+
+// contextSetAPIKey returns a new copy of the request with the provided APIKey struct
+// added to the context.
+func (app *application) contextSetAPIKey(r *http.Request, key *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// contextGetAPIKey retrieves the APIKey struct from the request context, or nil if the
+// request wasn't authenticated with an API key.
+func (app *application) contextGetAPIKey(r *http.Request) *data.APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	return key
+}
+
+// contextSetPermissions returns a new copy of the request with the provided
+// Permissions of the user added to the context.
+func (app *application) contextSetPermissions(r *http.Request, permissions data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+	return r.WithContext(ctx)
+}
+
+// contextGetPermissions retrieves the Permissions of the user from the request
+// context, or nil for anonymous users.
+func (app *application) contextGetPermissions(r *http.Request) data.Permissions {
+	permissions, _ := r.Context().Value(permissionsContextKey).(data.Permissions)
+	return permissions
+}
@@ -0,0 +1,504 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// responseEncoder encodes an envelope into a response body of a single media type,
+// returning the body along with the headers describing it.
+type responseEncoder interface {
+	encode(data envelope) ([]byte, http.Header, error)
+}
+
+// supportedMediaTypes holds the media types the responses can be encoded in, in order
+// of preference when the Accept header allows several of them.
+var supportedMediaTypes = []string{
+	"application/json",
+	"application/x-ndjson",
+	"text/csv",
+	"application/xml",
+	"text/xml",
+}
+
+// streamedMediaTypes holds the media types written directly by the handlers serving
+// them, rather than through writeJSON, such as the Server-Sent Events stream.
+var streamedMediaTypes = []string{
+	"text/event-stream",
+}
+
+// encodingResponseWriter carries the encoder negotiated for the request down to
+// writeJSON.
+type encodingResponseWriter struct {
+	wrapped http.ResponseWriter
+	encoder responseEncoder
+}
+
+func (ew *encodingResponseWriter) Header() http.Header {
+	return ew.wrapped.Header()
+}
+
+func (ew *encodingResponseWriter) WriteHeader(statusCode int) {
+	ew.wrapped.WriteHeader(statusCode)
+}
+
+func (ew *encodingResponseWriter) Write(b []byte) (int, error) {
+	return ew.wrapped.Write(b)
+}
+
+func (ew *encodingResponseWriter) Unwrap() http.ResponseWriter {
+	return ew.wrapped
+}
+
+// responseEncoder returns the encoder negotiated for the response, looking through
+// any other wrapping response writer, or the default encoder if there is none.
+func (app *application) responseEncoder(w http.ResponseWriter) responseEncoder {
+	for {
+		switch rw := w.(type) {
+		case *encodingResponseWriter:
+			return rw.encoder
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return app.defaultEncoder()
+		}
+	}
+}
+
+// defaultEncoder returns the encoder used when the client accepts any media type. JSON
+// is indented for readability, except in production where it is kept compact.
+func (app *application) defaultEncoder() responseEncoder {
+	return jsonEncoder{indent: app.config.env != "production"}
+}
+
+// negotiateEncoder picks the encoder for the most preferred media type in the Accept
+// header. A nil encoder is returned for the streamed media types, which are left to
+// the handlers, and ok is false if none of the accepted media types is supported.
+func (app *application) negotiateEncoder(accept string) (encoder responseEncoder, ok bool) {
+	if strings.TrimSpace(accept) == "" {
+		return app.defaultEncoder(), true
+	}
+
+	type mediaRange struct {
+		mediaType string
+		params    map[string]string
+		q         float64
+	}
+
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if s, exists := params["q"]; exists {
+			q, err = strconv.ParseFloat(s, 64)
+			if err != nil || q <= 0 {
+				continue
+			}
+		}
+
+		ranges = append(ranges, mediaRange{mediaType: mediaType, params: params, q: q})
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	for _, mr := range ranges {
+		for _, mediaType := range streamedMediaTypes {
+			if mr.mediaType == mediaType {
+				return nil, true
+			}
+		}
+
+		for _, mediaType := range supportedMediaTypes {
+			if !matchMediaRange(mr.mediaType, mediaType) {
+				continue
+			}
+
+			switch mediaType {
+			case "application/json":
+				if mr.mediaType != mediaType {
+					return app.defaultEncoder(), true
+				}
+				// Clients can pick the JSON layout with an indent parameter, such
+				// as "application/json; indent=false".
+				enc := app.defaultEncoder().(jsonEncoder)
+				if s, exists := mr.params["indent"]; exists {
+					enc.indent, _ = strconv.ParseBool(s)
+				}
+				return enc, true
+			case "application/x-ndjson":
+				return ndjsonEncoder{}, true
+			case "text/csv":
+				return csvEncoder{}, true
+			default:
+				return xmlEncoder{mediaType: mediaType}, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// matchMediaRange reports whether the media range from an Accept header, which may
+// contain wildcards such as "text/*", matches the media type.
+func matchMediaRange(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	prefix, found := strings.CutSuffix(mediaRange, "/*")
+	return found && strings.HasPrefix(mediaType, prefix+"/")
+}
+
+// jsonEncoder encodes the envelope as a single JSON object.
+type jsonEncoder struct {
+	indent bool
+}
+
+func (e jsonEncoder) encode(data envelope) ([]byte, http.Header, error) {
+	var js []byte
+	var err error
+	if e.indent {
+		js, err = json.MarshalIndent(data, "", "\t")
+	} else {
+		js, err = json.Marshal(data)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	js = append(js, '\n')
+
+	return js, http.Header{"Content-Type": {"application/json"}}, nil
+}
+
+// ndjsonEncoder encodes the records of a list response as newline-delimited JSON, one
+// record per line. Responses which aren't lists are sent as compact JSON.
+type ndjsonEncoder struct{}
+
+func (ndjsonEncoder) encode(data envelope) ([]byte, http.Header, error) {
+	key, list, ok := listValue(data)
+	if !ok {
+		return jsonEncoder{}.encode(data)
+	}
+
+	header, err := listHeaders(data, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	header.Set("Content-Type", "application/x-ndjson")
+
+	var buf bytes.Buffer
+	for i := 0; i < list.Len(); i++ {
+		js, err := json.Marshal(list.Index(i).Interface())
+		if err != nil {
+			return nil, nil, err
+		}
+		buf.Write(js)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), header, nil
+}
+
+// csvEncoder encodes the records of a list response as CSV, with a header row holding
+// the JSON field names. Responses which aren't lists of records are sent as compact
+// JSON.
+type csvEncoder struct{}
+
+func (csvEncoder) encode(data envelope) ([]byte, http.Header, error) {
+	key, list, ok := listValue(data)
+	if !ok {
+		return jsonEncoder{}.encode(data)
+	}
+
+	elemType := list.Type().Elem()
+	if elemType.Kind() == reflect.Pointer {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return jsonEncoder{}.encode(data)
+	}
+
+	type column struct {
+		name      string
+		index     int
+		omitEmpty bool
+	}
+
+	var columns []column
+	for i := 0; i < elemType.NumField(); i++ {
+		field := elemType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = field.Name
+		}
+
+		columns = append(columns, column{name: name, index: i, omitEmpty: strings.Contains(opts, "omitempty")})
+	}
+
+	header, err := listHeaders(data, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	header.Set("Content-Type", "text/csv; charset=utf-8")
+
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+
+	record := make([]string, len(columns))
+	for i, col := range columns {
+		record[i] = col.name
+	}
+	if err := cw.Write(record); err != nil {
+		return nil, nil, err
+	}
+
+	for i := 0; i < list.Len(); i++ {
+		elem := reflect.Indirect(list.Index(i))
+		if !elem.IsValid() {
+			continue
+		}
+
+		for j, col := range columns {
+			value := elem.Field(col.index)
+			if col.omitEmpty && value.IsZero() {
+				record[j] = ""
+				continue
+			}
+
+			// Encode through a pointer when possible, so that the pointer receiver
+			// methods of the field type, such as MarshalJSON, are used.
+			if value.CanAddr() {
+				value = value.Addr()
+			}
+
+			record[j], err = csvValue(value.Interface())
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		if err := cw.Write(record); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return nil, nil, err
+	}
+
+	return buf.Bytes(), header, nil
+}
+
+// csvValue formats a field as a CSV cell, using its JSON encoding so that types such
+// as Runtime are formatted consistently with the other media types. Lists of plain
+// values are comma-separated, like the genres query string parameter.
+func csvValue(v any) (string, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return "", err
+	}
+
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case []any:
+		items := make([]string, len(value))
+		for i, item := range value {
+			switch item.(type) {
+			case map[string]any, []any:
+				return string(js), nil
+			}
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]any:
+		return string(js), nil
+	default:
+		return fmt.Sprint(value), nil
+	}
+}
+
+// listValue returns the key and value of the list in a list response, which is an
+// envelope holding a single slice, plus any metadata.
+func listValue(data envelope) (string, reflect.Value, bool) {
+	var key string
+	var list reflect.Value
+
+	for k, v := range data {
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+			continue
+		}
+		if list.IsValid() {
+			return "", reflect.Value{}, false
+		}
+		key, list = k, rv
+	}
+
+	return key, list, list.IsValid()
+}
+
+// listHeaders returns the other values of a list response, such as the pagination
+// metadata, as JSON-encoded headers since they can't be included in the body.
+// The metadata key is sent as the X-Metadata header, for example.
+func listHeaders(data envelope, listKey string) (http.Header, error) {
+	header := make(http.Header)
+
+	for k, v := range data {
+		if k == listKey {
+			continue
+		}
+
+		js, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		header.Set("X-"+textproto.CanonicalMIMEHeaderKey(strings.ReplaceAll(k, "_", "-")), string(js))
+	}
+
+	return header, nil
+}
+
+// xmlEncoder encodes the envelope as an XML document with a <response> root element.
+// Objects become elements named after their keys, and the items of a list are named
+// after the singular of the list's key, such as <movies><movie>...</movie></movies>.
+type xmlEncoder struct {
+	mediaType string
+}
+
+func (e xmlEncoder) encode(data envelope) ([]byte, http.Header, error) {
+	// Go through the JSON encoding of the envelope, so that the XML document has the
+	// same field names, order and formatting as the JSON one.
+	js, err := json.Marshal(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "\t")
+
+	err = encodeXMLValue(enc, dec, xmlElement("response"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := enc.Flush(); err != nil {
+		return nil, nil, err
+	}
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), http.Header{"Content-Type": {e.mediaType + "; charset=utf-8"}}, nil
+}
+
+// encodeXMLValue reads the next JSON value from the decoder and encodes it as the
+// given XML element.
+func encodeXMLValue(enc *xml.Encoder, dec *json.Decoder, start xml.StartElement) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		item := xmlElement(singular(start.Name.Local))
+
+		for dec.More() {
+			if tok == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				item = xmlElement(key.(string))
+			}
+
+			if err := encodeXMLValue(enc, dec, item); err != nil {
+				return err
+			}
+		}
+
+		// Consume the closing delimiter.
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	case nil:
+	default:
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprint(tok))); err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// xmlNameRX matches the names which can be used as is for XML elements.
+var xmlNameRX = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// xmlElement returns the element for a JSON key. Keys which aren't valid XML names,
+// like some of the validation error keys, are encoded as <entry key="...">.
+func xmlElement(key string) xml.StartElement {
+	if xmlNameRX.MatchString(key) {
+		return xml.StartElement{Name: xml.Name{Local: key}}
+	}
+	return xml.StartElement{
+		Name: xml.Name{Local: "entry"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: key}},
+	}
+}
+
+// singular returns the element name for the items of a list, such as movie for
+// movies or delivery for deliveries, falling back to item.
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies") && !strings.HasSuffix(name, "vies"):
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "s") && len(name) > 1:
+		return strings.TrimSuffix(name, "s")
+	default:
+		return "item"
+	}
+}
@@ -2,7 +2,11 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // logError is a generic helper for logging an error message.
@@ -58,6 +62,13 @@ func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.
 	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
 
+// notAcceptableResponse writes 406 Not Acceptable and a message listing the supported
+// media types as JSON response.
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request) {
+	message := fmt.Sprintf("unable to produce a response in the requested media type, supported types are %s", strings.Join(supportedMediaTypes, ", "))
+	app.errorResponse(w, r, http.StatusNotAcceptable, message)
+}
+
 // editConflictResponse writes 409 Conflict and a message describing the error as JSON response.
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
 	message := "unable to update the record due to an edit conflict, please try again."
@@ -71,6 +82,15 @@ func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
 }
 
+// loginThrottledResponse writes 429 Too Many Requests with the time to wait before
+// logging in again. It is the same for delays and lockouts, and for unknown emails.
+func (app *application) loginThrottledResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+	message := "too many failed login attempts, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
 // invalidCredential response writes 401 Unauthorized header and a message describing the error
 // as JSON response.
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
@@ -95,7 +115,64 @@ func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.R
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
 
+func (app *application) deactivatedAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your account has been deactivated, please contact an administrator"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account does not have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+
+// twoFactorRequiredResponse writes 403 Forbidden for the permissions which can only be
+// used by the users who have enabled two-factor authentication.
+func (app *application) twoFactorRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you must enable two-factor authentication to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) twoFactorUnavailableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "two-factor authentication is not available on this server"
+	app.errorResponse(w, r, http.StatusServiceUnavailable, message)
+}
+
+func (app *application) oidcUnavailableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "logging in with an external provider is not available on this server"
+	app.errorResponse(w, r, http.StatusServiceUnavailable, message)
+}
+
+// oauthErrorResponse sends an error response of the OAuth token endpoint, which uses
+// the format of RFC 6749 rather than the error envelope of the other endpoints.
+func (app *application) oauthErrorResponse(w http.ResponseWriter, r *http.Request, status int, code, description string) {
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "no-store")
+	if status == http.StatusUnauthorized {
+		headers.Set("WWW-Authenticate", `Basic realm="greenlight"`)
+	}
+
+	env := envelope{"error": code, "error_description": description}
+
+	err := app.writeJSON(w, status, env, headers)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (app *application) invalidAPIKeyResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "ApiKey")
+
+	message := "invalid or missing API key"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) apiKeyAddressNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this API key can't be used from your IP address"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) delegatedAccessNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this resource can't be accessed with an API key or a token issued to an application"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hayohtee/greenlight/internal/data"
+	"github.com/lib/pq"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// movieEventHub fans out the movie events received by the single listener goroutine
+// to every connected subscriber.
+type movieEventHub struct {
+	mu          sync.Mutex
+	subscribers map[*movieEventSubscriber]struct{}
+	bufferSize  int
+}
+
+// movieEventSubscriber holds the buffered events waiting to be streamed to a single
+// client. The done channel is closed when the hub disconnects the subscriber.
+type movieEventSubscriber struct {
+	events chan *data.MovieEvent
+	done   chan struct{}
+}
+
+func newMovieEventHub(bufferSize int) *movieEventHub {
+	return &movieEventHub{
+		subscribers: make(map[*movieEventSubscriber]struct{}),
+		bufferSize:  bufferSize,
+	}
+}
+
+// subscribe registers a new subscriber which receives every event broadcast from now on.
+func (h *movieEventHub) subscribe() *movieEventSubscriber {
+	sub := &movieEventSubscriber{
+		events: make(chan *data.MovieEvent, h.bufferSize),
+		done:   make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+
+	return sub
+}
+
+// unsubscribe removes the subscriber from the hub, if it is still registered.
+func (h *movieEventHub) unsubscribe(sub *movieEventSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.done)
+	}
+}
+
+// broadcast sends the event to every subscriber. A subscriber whose buffer is full is
+// too slow to keep up, so it is disconnected rather than blocking everyone else. The
+// client can then reconnect and resume from its Last-Event-ID.
+func (h *movieEventHub) broadcast(event *data.MovieEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			delete(h.subscribers, sub)
+			close(sub.done)
+		}
+	}
+}
+
+// closeAll disconnects every subscriber. It is called when the server shuts down,
+// since the open streams would otherwise keep the shutdown waiting.
+func (h *movieEventHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers {
+		delete(h.subscribers, sub)
+		close(sub.done)
+	}
+}
+
+// listenForMovieEvents launches the background goroutine which listens for movie event
+// notifications from Postgres, invalidates the changed movies in the movie cache and
+// broadcasts the new events to the hub. The movies are invalidated straight from the
+// notifications, which carry the IDs of the event and of the movie, while the events
+// themselves are read from the movie_events table so that none are missed while the
+// listener is reconnecting.
+func (app *application) listenForMovieEvents() error {
+	lastID, err := app.models.MovieEvents.LatestID()
+	if err != nil {
+		return err
+	}
+
+	listener := pq.NewListener(app.config.db.dsn, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"task": "listen for movie events"})
+		}
+	})
+
+	err = listener.Listen(data.MovieEventsChannel)
+	if err != nil {
+		return err
+	}
+
+	app.background(func() {
+		defer listener.Close()
+
+		ping := time.NewTicker(90 * time.Second)
+		defer ping.Stop()
+
+		prune := time.NewTicker(time.Hour)
+		defer prune.Stop()
+
+		for {
+			select {
+			// A nil notification is sent after the connection has been re-established,
+			// in which case we fetch any event that has been recorded in the meantime.
+			// The movie cache is purged then, since the changes made while the listener
+			// was disconnected were missed.
+			case n := <-listener.NotificationChannel():
+				if app.models.Movies.Cache != nil {
+					app.invalidateCachedMovie(n)
+				}
+			case <-ping.C:
+				go listener.Ping()
+				continue
+			case <-prune.C:
+				err := app.models.MovieEvents.DeleteOlderThan(time.Now().Add(-app.config.events.retention))
+				if err != nil {
+					app.logger.PrintError(err, map[string]string{"task": "prune movie events"})
+				}
+				continue
+			case <-app.shutdown:
+				return
+			}
+
+			for {
+				events, err := app.models.MovieEvents.GetAfter(lastID, 500)
+				if err != nil {
+					app.logger.PrintError(err, map[string]string{"task": "listen for movie events"})
+					break
+				}
+
+				for _, event := range events {
+					app.events.broadcast(event)
+					lastID = event.ID
+				}
+
+				if len(events) < 500 {
+					break
+				}
+			}
+		}
+	})
+
+	return nil
+}
+
+// invalidateCachedMovie removes the movie changed by the notified event from the movie
+// cache, whichever instance changed it. The whole cache is purged when the notification
+// is nil, or can't be parsed.
+func (app *application) invalidateCachedMovie(n *pq.Notification) {
+	if n == nil {
+		app.models.Movies.Cache.Purge()
+		return
+	}
+
+	_, movieID, err := data.ParseMovieEventNotification(n.Extra)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"task": "listen for movie events"})
+		app.models.Movies.Cache.Purge()
+		return
+	}
+
+	app.models.Movies.Cache.Invalidate(movieID)
+}
+
+// movieEventsHandler streams movie changes to the client as Server-Sent Events. If the
+// client sends a Last-Event-ID header, the events recorded since then are replayed
+// before streaming new ones.
+func (app *application) movieEventsHandler(w http.ResponseWriter, r *http.Request) {
+	var lastEventID int64
+	if s := r.Header.Get("Last-Event-ID"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || id < 0 {
+			app.badRequestResponse(w, r, fmt.Errorf("invalid Last-Event-ID header"))
+			return
+		}
+		lastEventID = id
+	}
+
+	// Subscribe before reading the backlog, so that no event is missed in between.
+	// Events received through both are deduplicated using their ID.
+	sub := app.events.subscribe()
+	defer app.events.unsubscribe(sub)
+
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// write sends the formatted text to the client straight away. The server write
+	// timeout would otherwise end the stream, so the write deadline is pushed back
+	// before every write.
+	write := func(format string, args ...any) error {
+		err := rc.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, format, args...)
+		if err != nil {
+			return err
+		}
+
+		return rc.Flush()
+	}
+
+	send := func(event *data.MovieEvent) error {
+		if event.ID <= lastEventID {
+			return nil
+		}
+
+		js, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		err = write("id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Event, js)
+		if err != nil {
+			return err
+		}
+
+		lastEventID = event.ID
+		return nil
+	}
+
+	// Tell the client how long to wait before reconnecting, which also flushes the
+	// headers to the client.
+	if err := write("retry: 3000\n\n"); err != nil {
+		return
+	}
+
+	// Replay the events the client missed, a page at a time.
+	for lastEventID > 0 {
+		backlog, err := app.models.MovieEvents.GetAfter(lastEventID, 500)
+		if err != nil {
+			app.logError(r, err)
+			return
+		}
+
+		for _, event := range backlog {
+			if err := send(event); err != nil {
+				return
+			}
+		}
+
+		if len(backlog) < 500 {
+			break
+		}
+	}
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event := <-sub.events:
+			if err := send(event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			// Send a comment line to keep intermediate proxies from closing the connection.
+			if err := write(": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-sub.done:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
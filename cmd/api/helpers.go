@@ -7,10 +7,13 @@ import (
 	"github.com/hayohtee/greenlight/internal/validator"
 	"github.com/julienschmidt/httprouter"
 	"io"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Define an envelope type.
@@ -27,26 +30,83 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+// readInt64Param retrieve the named URL parameter from the current context, then
+// convert it to a positive integer and return it.
+func (app *application) readInt64Param(r *http.Request, name string) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	i, err := strconv.ParseInt(params.ByName(name), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if i < 1 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
+	}
+	return i, nil
+}
+
 // writeJSON encode the data into json and send it as response. This takes destination
 // http.ResponseWrite, the HTTP status code to send, data to encode, and a header
 // map containing any additional HTTP headers we want to include in the response.
+// The data is encoded in the media type negotiated by the negotiateContent middleware
+// from the Accept header, which is JSON unless the client asks for another format.
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
-	js, err := json.MarshalIndent(data, "", "\t")
+	body, bodyHeaders, err := app.responseEncoder(w).encode(data)
 	if err != nil {
 		return err
 	}
-	js = append(js, '\n')
 
 	for key, value := range headers {
 		w.Header()[key] = value
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	for key, value := range bodyHeaders {
+		w.Header()[key] = value
+	}
+
 	w.WriteHeader(status)
-	_, err = w.Write(js)
+	_, err = w.Write(body)
 	return err
 }
 
+// notModified sets the caching headers of a response, the ETag and Last-Modified
+// validators and the configured Cache-Control, then checks them against the request's
+// conditional headers. It returns true if the client's copy is still fresh, in which
+// case a 304 Not Modified response has already been sent.
+func (app *application) notModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	// HTTP dates have a one second precision.
+	lastModified = lastModified.UTC().Truncate(time.Second)
+
+	w.Header().Set("Cache-Control", app.config.cache.control)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	fresh := false
+
+	// If-None-Match takes precedence over If-Modified-Since when both are sent. The
+	// ETags are weak, so they are compared ignoring the W/ prefix.
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				fresh = true
+				break
+			}
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		fresh = err == nil && !lastModified.After(t)
+	}
+
+	if fresh {
+		w.WriteHeader(http.StatusNotModified)
+	}
+	return fresh
+}
+
 // readJSON decode the JSON request to the passed destination, it catches all kinds of error and
 // return a more descriptive error if there is one.
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
@@ -133,6 +193,38 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// readBool reads a boolean value from the query string, returning nil if no matching
+// key could be found. If the value is neither true nor false, then we record an error
+// message in the provided validator instance.
+func (app *application) readBool(qs url.Values, key string, v *validator.Validator) *bool {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+	if s != "true" && s != "false" {
+		v.AddError(key, "must be true or false")
+		return nil
+	}
+	b := s == "true"
+	return &b
+}
+
+// readTime reads an RFC 3339 timestamp from the query string, returning nil if no
+// matching key could be found. If the value could not be parsed, then we record an
+// error message in the provided validator instance.
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		v.AddError(key, "must be an RFC 3339 timestamp")
+		return nil
+	}
+	return &t
+}
+
 // background accepts an arbitrary function as a parameter launch the function
 // in a new goroutine and handle panic.
 func (app *application) background(fn func()) {
@@ -147,3 +239,80 @@ func (app *application) background(fn func()) {
 		fn()
 	}()
 }
+
+// periodically launches a background goroutine which calls fn once every interval,
+// until the server shuts down. As for the goroutines launched by background, the
+// shutdown waits for the current call to return.
+func (app *application) periodically(interval time.Duration, fn func()) {
+	app.background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-app.shutdown:
+				return
+			}
+		}
+	})
+}
+
+// clientIP returns the address of the client which sent the request. Clients can set
+// the X-Forwarded-For and X-Real-Ip headers to anything, so they are only read from the
+// requests sent by a trusted proxy. The client is then the closest address of the
+// X-Forwarded-For chain which isn't a trusted proxy itself.
+func (app *application) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+
+	if !app.trustedProxy(addr) {
+		return addr.String()
+	}
+
+	if forwardedFor := r.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+		hops := strings.Split(strings.Join(forwardedFor, ","), ",")
+
+		// Walk the chain back from the proxy which sent the request. Each proxy appends
+		// the address it received the request from, so the addresses before the first
+		// untrusted one were set by the client and are ignored.
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				break
+			}
+			addr = hop.Unmap()
+
+			if !app.trustedProxy(addr) {
+				break
+			}
+		}
+
+		return addr.String()
+	}
+
+	if realIP, err := netip.ParseAddr(r.Header.Get("X-Real-Ip")); err == nil {
+		return realIP.Unmap().String()
+	}
+
+	return addr.String()
+}
+
+// trustedProxy reports whether the address is one of the trusted proxies.
+func (app *application) trustedProxy(addr netip.Addr) bool {
+	for _, prefix := range app.config.proxies.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	var app application
+	app.config.proxies.trusted = []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("::1/128"),
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		realIP       string
+		want         string
+	}{
+		{"direct", "203.0.113.7:4321", nil, "", "203.0.113.7"},
+		{"direct IPv6", "[2001:db8::1]:4321", nil, "", "2001:db8::1"},
+		{"IPv4-mapped", "[::ffff:203.0.113.7]:4321", nil, "", "203.0.113.7"},
+		{"spoofed X-Forwarded-For", "203.0.113.7:4321", []string{"10.1.2.3"}, "", "203.0.113.7"},
+		{"spoofed X-Real-Ip", "203.0.113.7:4321", nil, "10.1.2.3", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.1:4321", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"trusted proxies", "[::1]:4321", []string{"198.51.100.1, 10.0.0.2", "10.0.0.3"}, "", "198.51.100.1"},
+		{"client prepending addresses", "10.0.0.1:4321", []string{"10.9.9.9, 198.51.100.1"}, "", "198.51.100.1"},
+		{"invalid hop", "10.0.0.1:4321", []string{"198.51.100.1, unknown, 10.0.0.2"}, "", "10.0.0.2"},
+		{"only trusted proxies", "10.0.0.1:4321", []string{"10.0.0.2"}, "", "10.0.0.2"},
+		{"trusted proxy X-Real-Ip", "10.0.0.1:4321", nil, "198.51.100.1", "198.51.100.1"},
+		{"trusted proxy without headers", "10.0.0.1:4321", nil, "", "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/healthcheck", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-Ip", tt.realIP)
+			}
+
+			if got := app.clientIP(r); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hayohtee/greenlight/internal/data"
+	"github.com/hayohtee/greenlight/internal/validator"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+func (app *application) createListHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Visibility  string `json:"visibility"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	list := &data.List{
+		UserID:      app.contextGetUser(r).ID,
+		Name:        input.Name,
+		Description: input.Description,
+		Visibility:  input.Visibility,
+	}
+
+	// Lists are private unless the client explicitly asks otherwise.
+	if list.Visibility == "" {
+		list.Visibility = data.ListVisibilityPrivate
+	}
+
+	v := validator.New()
+	if data.ValidateList(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.Insert(list)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/lists/%d", list.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"list": list}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listListsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Sort = app.readString(qs, "sort", "id")
+	input.SortSafeList = []string{"id", "name", "created_at", "-id", "-name", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	lists, metadata, err := app.models.Lists.GetAllForUser(app.contextGetUser(r).ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"lists": lists, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showListHandler is reachable by anonymous users, who can only see public lists.
+func (app *application) showListHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	list, err := app.models.Lists.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Respond with 404 Not Found rather than 403 Forbidden, so that clients can't
+	// probe for the existence of other users' private lists.
+	user := app.contextGetUser(r)
+	if !list.IsVisibleTo(user) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	app.writeList(w, r, list, user)
+}
+
+// showSharedListHandler looks up a list by its share token. This gives access to
+// unlisted lists as well as public ones, but never to private lists.
+func (app *application) showSharedListHandler(w http.ResponseWriter, r *http.Request) {
+	shareToken := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	v := validator.New()
+	if data.ValidateShareToken(v, shareToken); !v.Valid() {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	list, err := app.models.Lists.GetByShareToken(shareToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if list.Visibility == data.ListVisibilityPrivate && !list.IsOwnedBy(user) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	app.writeList(w, r, list, user)
+}
+
+func (app *application) updateListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnedList(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name                 *string `json:"name"`
+		Description          *string `json:"description"`
+		Visibility           *string `json:"visibility"`
+		RegenerateShareToken bool    `json:"regenerate_share_token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		list.Name = *input.Name
+	}
+	if input.Description != nil {
+		list.Description = *input.Description
+	}
+	if input.Visibility != nil {
+		list.Visibility = *input.Visibility
+	}
+	if input.RegenerateShareToken {
+		err = list.RegenerateShareToken()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	v := validator.New()
+	if data.ValidateList(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.Update(list)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeList(w, r, list, app.contextGetUser(r))
+}
+
+func (app *application) deleteListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnedList(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Lists.Delete(list.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "list deleted successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) addListItemHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnedList(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		MovieID  int64  `json:"movie_id"`
+		Position int    `json:"position"`
+		Notes    string `json:"notes"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	item := &data.ListItem{
+		ListID:   list.ID,
+		MovieID:  input.MovieID,
+		Position: input.Position,
+		Notes:    input.Notes,
+	}
+
+	v := validator.New()
+	if data.ValidateListItem(v, item); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.AddItem(item)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateListItem):
+			v.AddError("movie_id", "this movie is already in the list")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("movie_id", "no matching movie found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"item": item}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateListItemHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnedList(w, r)
+	if !ok {
+		return
+	}
+
+	movieID, err := app.readInt64Param(r, "movie_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	items, err := app.models.Lists.GetItems(list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var item *data.ListItem
+	for i := range items {
+		if items[i].MovieID == movieID {
+			item = items[i]
+			break
+		}
+	}
+
+	if item == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Position *int    `json:"position"`
+		Notes    *string `json:"notes"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Position != nil {
+		item.Position = *input.Position
+	}
+	if input.Notes != nil {
+		item.Notes = *input.Notes
+	}
+
+	v := validator.New()
+	if data.ValidateListItem(v, item); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.UpdateItem(item)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"item": item}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteListItemHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnedList(w, r)
+	if !ok {
+		return
+	}
+
+	movieID, err := app.readInt64Param(r, "movie_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Lists.DeleteItem(list.ID, movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie removed from list successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readOwnedList fetches the list identified by the "id" URL parameter and checks
+// that it belongs to the current user. If it doesn't, or anything else goes wrong,
+// an error response is sent to the client and false is returned.
+func (app *application) readOwnedList(w http.ResponseWriter, r *http.Request) (*data.List, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	list, err := app.models.Lists.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if !list.IsOwnedBy(app.contextGetUser(r)) {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	return list, true
+}
+
+// writeList loads the items of the list and sends it as JSON response. The share
+// token is only included when the list is viewed by its owner.
+func (app *application) writeList(w http.ResponseWriter, r *http.Request, list *data.List, user *data.User) {
+	items, err := app.models.Lists.GetItems(list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	list.Items = items
+
+	if !list.IsOwnedBy(user) {
+		list.ShareToken = ""
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
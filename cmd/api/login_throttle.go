@@ -0,0 +1,112 @@
+package main
+
+import (
+	"github.com/hayohtee/greenlight/internal/data"
+	"net/http"
+	"time"
+)
+
+// loginPolicy returns the thresholds applied to failed logins.
+func (app *application) loginPolicy() data.LoginPolicy {
+	return data.LoginPolicy{
+		DelayThreshold:     app.config.login.delayThreshold,
+		MaxDelay:           app.config.login.maxDelay,
+		LockoutThreshold:   app.config.login.lockoutThreshold,
+		IPLockoutThreshold: app.config.login.ipLockoutThreshold,
+		LockoutDuration:    app.config.login.lockoutDuration,
+		Window:             app.config.login.failureWindow,
+	}
+}
+
+// loginRetryAfter returns how long the client must wait before trying to log in to the
+// account with the email address, zero if it can try now, along with the failure
+// counter of the account if there is one.
+func (app *application) loginRetryAfter(email, ip string) (time.Duration, *data.LoginFailure, error) {
+	failures, err := app.models.LoginFailures.Get(data.AccountKey(email), ip)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var retryAfter time.Duration
+	for _, failure := range failures {
+		retryAfter = max(retryAfter, failure.RetryAfter(app.loginPolicy(), time.Now()))
+	}
+
+	return retryAfter, failures[data.LoginFailureAccount], nil
+}
+
+// recordLoginFailure counts a failed login for the account with the email address and
+// for the client IP address. The user is nil when no user has the email address, and
+// is notified by email when their account gets locked out.
+func (app *application) recordLoginFailure(email, ip string, user *data.User) error {
+	policy := app.loginPolicy()
+
+	failure, locked, err := app.models.LoginFailures.RecordFailure(data.LoginFailureAccount, data.AccountKey(email), policy.Window, policy.LockoutThreshold, policy.LockoutDuration)
+	if err != nil {
+		return err
+	}
+
+	if locked && user != nil {
+		app.background(func() {
+			templateData := map[string]any{
+				"failures":    failure.Failures,
+				"lockedUntil": failure.LockedUntil.UTC().Format(time.RFC1123),
+			}
+
+			err := app.mailer.Send(user.Email, "account_locked.tmpl", templateData)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+
+	_, locked, err = app.models.LoginFailures.RecordFailure(data.LoginFailureIP, ip, policy.Window, policy.IPLockoutThreshold, policy.LockoutDuration)
+	if err != nil {
+		return err
+	}
+
+	if locked {
+		app.logger.PrintInfo("IP address locked out after failed logins", map[string]string{"ip": ip})
+	}
+
+	return nil
+}
+
+// resetLoginFailures forgets the failed logins of the account once the user proved who
+// they are, if there were any. The ones from the client IP address are kept, so that an
+// attacker can't reset them by logging in to an account of their own.
+func (app *application) resetLoginFailures(failure *data.LoginFailure) error {
+	if failure == nil {
+		return nil
+	}
+
+	return app.models.LoginFailures.Reset(data.LoginFailureAccount, failure.Key)
+}
+
+// verifyPassword checks the password of the authenticated user before a sensitive
+// change. A wrong password counts as a failed login, so that a stolen session can't be
+// used to guess the password faster than logging in would. It returns how long the
+// client must wait instead, without checking the password, while the account or the
+// client is delayed or locked out.
+func (app *application) verifyPassword(r *http.Request, user *data.User, password string) (bool, time.Duration, error) {
+	ip := app.clientIP(r)
+
+	retryAfter, _, err := app.loginRetryAfter(user.Email, ip)
+	if err != nil || retryAfter > 0 {
+		return false, retryAfter, err
+	}
+
+	match, err := user.Password.Matches(password)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if !match {
+		err = app.recordLoginFailure(user.Email, ip, user)
+		if err != nil {
+			return false, 0, err
+		}
+	}
+
+	return match, 0, nil
+}
@@ -3,13 +3,21 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"errors"
 	"expvar"
 	"flag"
 	"fmt"
 	"github.com/hayohtee/greenlight/internal/data"
+	"github.com/hayohtee/greenlight/internal/encryption"
 	"github.com/hayohtee/greenlight/internal/jsonlog"
+	"github.com/hayohtee/greenlight/internal/jwt"
 	"github.com/hayohtee/greenlight/internal/mailer"
+	"github.com/hayohtee/greenlight/internal/oidc"
+	"github.com/hayohtee/greenlight/internal/passwords"
+	"github.com/hayohtee/greenlight/internal/webhook"
 	_ "github.com/lib/pq"
+	"net/http"
 	"os"
 	"runtime"
 	"strings"
@@ -36,6 +44,80 @@ func main() {
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
 
+	// Reads the trusted reverse proxies from the command-line flags into the config struct.
+	flag.Func("trusted-proxies", "Trusted reverse proxy addresses or CIDR blocks (space separated)", func(val string) error {
+		for _, field := range strings.Fields(val) {
+			prefix, err := data.ParseIPPrefix(field)
+			if err != nil {
+				return err
+			}
+			cfg.proxies.trusted = append(cfg.proxies.trusted, prefix)
+		}
+		return nil
+	})
+
+	// Reads the user account settings from the command-line flags into the config struct.
+	flag.StringVar(&cfg.users.defaultRole, "users-default-role", "viewer", "Role given to new users, none if empty")
+	flag.DurationVar(&cfg.users.deletionGracePeriod, "users-deletion-grace-period", 30*24*time.Hour, "Time during which users can cancel the deletion of their account")
+	flag.DurationVar(&cfg.users.deletionInterval, "users-deletion-interval", time.Hour, "Interval at which the users due for deletion are deleted")
+
+	// Reads the password policy settings from the command-line flags into the config struct.
+	flag.Float64Var(&cfg.password.minEntropy, "password-min-entropy", 35, "Minimum estimated strength of passwords in bits")
+	flag.StringVar(&cfg.password.breachedCorpus, "password-breached-corpus", "", "Path of a file of breached password SHA-1 hashes, sorted as in the Pwned Passwords downloads ordered by hash")
+
+	// Reads the login throttling settings from the command-line flags into the config struct.
+	flag.IntVar(&cfg.login.delayThreshold, "login-delay-threshold", 3, "Failed logins for an account before delays are required between attempts (0 disables delays)")
+	flag.DurationVar(&cfg.login.maxDelay, "login-max-delay", time.Minute, "Maximum delay between login attempts for an account")
+	flag.IntVar(&cfg.login.lockoutThreshold, "login-lockout-threshold", 10, "Failed logins for an account before it is locked out (0 disables lockouts)")
+	flag.IntVar(&cfg.login.ipLockoutThreshold, "login-ip-lockout-threshold", 100, "Failed logins from an IP address before it is locked out (0 disables lockouts)")
+	flag.DurationVar(&cfg.login.lockoutDuration, "login-lockout-duration", 15*time.Minute, "Login lockout duration")
+	flag.DurationVar(&cfg.login.failureWindow, "login-failure-window", time.Hour, "Time after which failed logins are forgotten")
+
+	// Reads the response compression settings from the command-line flags into the config struct.
+	flag.BoolVar(&cfg.compression.enabled, "compression-enabled", true, "Enable response compression")
+	flag.IntVar(&cfg.compression.minSize, "compression-min-size", 1024, "Minimum response body size in bytes to compress")
+
+	// Reads the HTTP caching settings from the command-line flags into the config struct.
+	flag.StringVar(&cfg.cache.control, "cache-control", "private, no-cache", "Cache-Control header for movie responses")
+
+	// Reads the movie cache settings from the command-line flags into the config struct.
+	flag.BoolVar(&cfg.movieCache.enabled, "movie-cache-enabled", true, "Enable the in-process movie cache")
+	flag.IntVar(&cfg.movieCache.size, "movie-cache-size", 10_000, "Movie cache maximum entries")
+	flag.DurationVar(&cfg.movieCache.ttl, "movie-cache-ttl", 5*time.Minute, "Movie cache entry time to live")
+
+	// Reads the permission cache settings from the command-line flags into the config struct.
+	flag.BoolVar(&cfg.permissionCache.enabled, "permission-cache-enabled", true, "Enable the in-process permission cache")
+	flag.IntVar(&cfg.permissionCache.size, "permission-cache-size", 10_000, "Permission cache maximum entries")
+	flag.DurationVar(&cfg.permissionCache.ttl, "permission-cache-ttl", time.Minute, "Permission cache entry time to live")
+
+	// Reads the token lifetimes from the command-line flags into the config struct.
+	flag.DurationVar(&cfg.tokens.authenticationTTL, "tokens-authentication-ttl", 15*time.Minute, "Authentication token lifetime")
+	flag.DurationVar(&cfg.tokens.refreshTTL, "tokens-refresh-ttl", 30*24*time.Hour, "Refresh token lifetime")
+	flag.StringVar(&cfg.tokens.mode, "tokens-mode", tokensModeDatabase, "Authentication tokens issued (database|signed)")
+	flag.StringVar(&cfg.tokens.signingKeys, "tokens-signing-keys", "", "Signed token keys as space separated kid:base64-secret pairs, the first one signing new tokens")
+	flag.DurationVar(&cfg.tokens.revocationSyncInterval, "tokens-revocation-sync-interval", 10*time.Second, "Revoked signed tokens reload interval")
+
+	// Reads the OAuth authorization server settings from the command-line flags into the config struct.
+	flag.StringVar(&cfg.oauth.issuer, "oauth-issuer", "http://localhost:4000", "Public URL of the server, identifying it as an OAuth authorization server")
+
+	// Reads the external OpenID Connect provider settings from the command-line flags into the config struct.
+	flag.StringVar(&cfg.oidc.issuer, "oidc-issuer", "", "Issuer URL of the OpenID Connect provider users can log in with, logging in with a provider is unavailable without it")
+	flag.StringVar(&cfg.oidc.clientID, "oidc-client-id", "", "Client ID registered with the OpenID Connect provider")
+	flag.StringVar(&cfg.oidc.clientSecret, "oidc-client-secret", "", "Client secret registered with the OpenID Connect provider, empty for public clients")
+	flag.StringVar(&cfg.oidc.redirectURI, "oidc-redirect-uri", "", "Redirect URI registered with the OpenID Connect provider")
+
+	// Reads the two-factor authentication settings from the command-line flags into the config struct.
+	flag.StringVar(&cfg.twoFactor.encryptionKey, "two-factor-encryption-key", "", "Base64 encoded 32 bytes key encrypting the TOTP secrets, two-factor authentication is unavailable without it")
+	flag.StringVar(&cfg.twoFactor.issuer, "two-factor-issuer", "Greenlight", "Issuer name shown by authenticator apps")
+	cfg.twoFactor.requiredPermissions = []string{"movies:write"}
+	flag.Func("two-factor-required-permissions", "Permission codes only usable with two-factor authentication enabled, when it is available (space separated, default movies:write)", func(val string) error {
+		cfg.twoFactor.requiredPermissions = strings.Fields(val)
+		return nil
+	})
+
+	// Reads the account activation settings from the command-line flags into the config struct.
+	flag.DurationVar(&cfg.activation.resendCooldown, "activation-resend-cooldown", 5*time.Minute, "Minimum time between activation emails sent to a user")
+
 	// Reads the SMTP server configuration settings from the command-line flags into the config struct.
 	flag.StringVar(&cfg.smtp.host, "smtp-host", "sandbox.smtp.mailtrap.io", "SMTP host")
 	flag.IntVar(&cfg.smtp.port, "smtp-port", 2525, "SMTP port")
@@ -48,6 +130,21 @@ func main() {
 		return nil
 	})
 
+	// Reads the catalog statistics settings from the command-line flags into the config struct.
+	flag.DurationVar(&cfg.stats.refreshInterval, "stats-refresh-interval", 15*time.Minute, "Catalog statistics refresh interval")
+
+	// Reads the webhook delivery settings from the command-line flags into the config struct.
+	flag.DurationVar(&cfg.webhooks.pollInterval, "webhooks-poll-interval", 5*time.Second, "Webhook delivery queue poll interval")
+	flag.IntVar(&cfg.webhooks.maxAttempts, "webhooks-max-attempts", 10, "Webhook delivery maximum attempts")
+	flag.DurationVar(&cfg.webhooks.timeout, "webhooks-timeout", 10*time.Second, "Webhook delivery timeout")
+
+	// Reads the movie change stream settings from the command-line flags into the config struct.
+	flag.IntVar(&cfg.events.bufferSize, "events-buffer-size", 64, "Movie events buffered per stream subscriber")
+	flag.DurationVar(&cfg.events.retention, "events-retention", 24*time.Hour, "Movie events retention for resuming streams")
+
+	// Reads the OpenAPI settings from the command-line flags into the config struct.
+	flag.BoolVar(&cfg.openapi.validate, "openapi-validate", true, "Validate requests against the OpenAPI document (development only)")
+
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 	flag.Parse()
 
@@ -91,14 +188,120 @@ func main() {
 		return time.Now().Unix()
 	}))
 
+	if cfg.tokens.mode != tokensModeDatabase && cfg.tokens.mode != tokensModeSigned {
+		logger.PrintFatal(fmt.Errorf("invalid tokens mode %q", cfg.tokens.mode), nil)
+	}
+
+	// Signed tokens are verified whenever keys are configured, so that the tokens
+	// already issued stay valid when switching back to the database mode.
+	var signingKeys *jwt.KeyRing
+	if cfg.tokens.signingKeys != "" {
+		signingKeys, err = jwt.ParseKeyRing(cfg.tokens.signingKeys)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	} else if cfg.tokens.mode == tokensModeSigned {
+		logger.PrintFatal(errors.New("signing keys must be provided for the signed tokens mode"), nil)
+	}
+
+	var twoFactorCipher *encryption.Cipher
+	if cfg.twoFactor.encryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(cfg.twoFactor.encryptionKey)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		twoFactorCipher, err = encryption.New(key)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+
+	var oidcProvider *oidc.Provider
+	if cfg.oidc.issuer != "" {
+		if cfg.oidc.clientID == "" || cfg.oidc.redirectURI == "" {
+			logger.PrintFatal(errors.New("a client ID and a redirect URI must be provided for the OpenID Connect provider"), nil)
+		}
+
+		client := &http.Client{Timeout: 10 * time.Second}
+		oidcProvider = oidc.New(cfg.oidc.issuer, cfg.oidc.clientID, cfg.oidc.clientSecret, cfg.oidc.redirectURI, client)
+	}
+
+	passwordPolicy := &passwords.Policy{MinEntropy: cfg.password.minEntropy}
+	if cfg.password.breachedCorpus != "" {
+		passwordPolicy.Breached, err = passwords.Open(cfg.password.breachedCorpus)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+
+	models := data.NewModels(db)
+
+	// Check that the default role exists, rather than registering users without it.
+	if cfg.users.defaultRole != "" {
+		_, err = models.Roles.GetByName(cfg.users.defaultRole)
+		if err != nil {
+			logger.PrintFatal(fmt.Errorf("default role %q: %w", cfg.users.defaultRole, err), nil)
+		}
+	}
+
+	if cfg.movieCache.enabled {
+		models.Movies.Cache = data.NewMovieCache(cfg.movieCache.size, cfg.movieCache.ttl)
+
+		// Publish the movie cache hit, miss and eviction counters.
+		expvar.Publish("movie_cache", expvar.Func(func() any {
+			return models.Movies.Cache.Stats()
+		}))
+	}
+
+	if cfg.permissionCache.enabled {
+		models.Permissions.Cache = data.NewPermissionCache(cfg.permissionCache.size, cfg.permissionCache.ttl)
+		models.Roles.PermissionCache = models.Permissions.Cache
+
+		// Publish the permission cache hit, miss, eviction and invalidation counters.
+		expvar.Publish("permission_cache", expvar.Func(func() any {
+			return models.Permissions.Cache.Stats()
+		}))
+	}
+
 	// Create an instance of application struct
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:   cfg,
+		logger:   logger,
+		models:   models,
+		mailer:   mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		webhooks: webhook.New(cfg.webhooks.timeout),
+		events:   newMovieEventHub(cfg.events.bufferSize),
+
+		signingKeys: signingKeys,
+		revocations: newRevocationList(),
+
+		twoFactorCipher: twoFactorCipher,
+		passwordPolicy:  passwordPolicy,
+		oidcProvider:    oidcProvider,
+
+		shutdown: make(chan struct{}),
+	}
+
+	err = app.listenForMovieEvents()
+	if err != nil {
+		logger.PrintFatal(err, nil)
 	}
 
+	err = app.listenForPermissionChanges()
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	err = app.syncRevocationsPeriodically()
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	app.refreshStatsPeriodically()
+	app.deliverWebhooksPeriodically()
+	app.deleteUsersPeriodically()
+
 	err = app.serve()
 	if err != nil {
 		logger.PrintFatal(err, nil)
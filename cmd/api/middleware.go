@@ -5,10 +5,11 @@ import (
 	"expvar"
 	"fmt"
 	"github.com/hayohtee/greenlight/internal/data"
+	"github.com/hayohtee/greenlight/internal/jwt"
 	"github.com/hayohtee/greenlight/internal/validator"
-	"github.com/tomasen/realip"
 	"golang.org/x/time/rate"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -89,7 +90,7 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if app.config.limiter.enabled {
-			ip := realip.FromRequest(r)
+			ip := app.clientIP(r)
 
 			mu.Lock()
 
@@ -117,6 +118,9 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 }
 
 func (app *application) authenticate(next http.Handler) http.Handler {
+	// Load the permissions of the user once authenticated, whichever way they were.
+	next = app.loadPermissions(next)
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Add "Vary: Authorization" header to the response. This indicates to any
 		// caches that the response may vary based on the value of the Authorization header
@@ -131,12 +135,46 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		headerParts := strings.Split(authorizationHeader, " ")
-		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		if len(headerParts) != 2 {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		// API keys use their own scheme, so that they are never mistaken for tokens.
+		if headerParts[0] == "ApiKey" {
+			app.authenticateAPIKey(w, r, headerParts[1], next)
+			return
+		}
+
+		// Basic credentials are only used by OAuth clients on the token endpoint, which
+		// authenticates them itself.
+		if headerParts[0] == "Basic" && r.URL.Path == "/v1/oauth/token" {
+			r = app.contextSetup(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if headerParts[0] != "Bearer" {
 			app.invalidAuthenticationTokenResponse(w, r)
 			return
 		}
 
 		token := headerParts[1]
+
+		// Signed tokens are verified without querying the database.
+		if jwt.LooksLikeToken(token) {
+			user, session, err := app.verifySignedToken(token)
+			if err != nil {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			r = app.contextSetup(r, user)
+			r = app.contextSetSession(r, session)
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		v := validator.New()
 
 		if data.ValidateTokenPlainText(v, token); !v.Valid() {
@@ -144,7 +182,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+		user, session, err := app.models.Users.GetForSession(token)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -155,7 +193,80 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		// Record when the session was last used, at most once a minute and in the
+		// background so that requests don't wait on the write.
+		if session.NeedsTouch() {
+			app.background(func() {
+				err := app.models.Tokens.TouchSession(session.ID)
+				if err != nil {
+					app.logger.PrintError(err, nil)
+				}
+			})
+		}
+
 		r = app.contextSetup(r, user)
+		r = app.contextSetSession(r, session)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticateAPIKey authenticates the request with the API key, checking that it is
+// used from an allowed address.
+func (app *application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, plainText string, next http.Handler) {
+	v := validator.New()
+
+	if data.ValidateAPIKeyPlainText(v, plainText); !v.Valid() {
+		app.invalidAPIKeyResponse(w, r)
+		return
+	}
+
+	user, key, err := app.models.Users.GetForAPIKey(plainText)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAPIKeyResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !key.AllowsIP(app.clientIP(r)) {
+		app.apiKeyAddressNotAllowedResponse(w, r)
+		return
+	}
+
+	if key.NeedsTouch() {
+		app.background(func() {
+			err := app.models.APIKeys.Touch(key.ID)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+
+	r = app.contextSetup(r, user)
+	r = app.contextSetAPIKey(r, key)
+	next.ServeHTTP(w, r)
+}
+
+// loadPermissions adds the effective permissions of the authenticated user to the
+// request context, so that they are read once per request however many checks are made.
+func (app *application) loadPermissions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+		if user.IsAnonymous() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		r = app.contextSetPermissions(r, permissions)
 		next.ServeHTTP(w, r)
 	})
 }
@@ -185,24 +296,66 @@ func (app *application) requireActivatedUser(next http.HandlerFunc) http.Handler
 
 func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		user := app.contextGetUser(r)
+		if !app.contextGetPermissions(r).Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
 
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
-		if err != nil {
-			app.serverErrorResponse(w, r, err)
+		// Requests authenticated with an API key are also restricted to the
+		// permissions of the key, and the ones authenticated with a token issued to
+		// an OAuth client to the granted scopes.
+		if key := app.contextGetAPIKey(r); key != nil && !data.Permissions(key.Permissions).Include(code) {
+			app.notPermittedResponse(w, r)
 			return
 		}
 
-		if !permissions.Include(code) {
+		if session := app.contextGetSession(r); session != nil && session.ClientID != 0 && !data.Permissions(session.Scopes).Include(code) {
 			app.notPermittedResponse(w, r)
 			return
 		}
 
+		// Some permissions can only be used once the user has enabled two-factor
+		// authentication. This applies to API keys and OAuth clients as well, since
+		// they are registered from a session of the user.
+		if app.twoFactorRequired(code) {
+			twoFactor, err := app.models.TwoFactor.Get(app.contextGetUser(r).ID)
+			if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			if twoFactor == nil || !twoFactor.Enabled() {
+				app.twoFactorRequiredResponse(w, r)
+				return
+			}
+		}
+
 		next.ServeHTTP(w, r)
 	}
 	return app.requireActivatedUser(fn)
 }
 
+// twoFactorRequired reports whether the permission can only be used by the users who
+// have enabled two-factor authentication. Nothing is required while two-factor
+// authentication is unavailable, as no user could enable it.
+func (app *application) twoFactorRequired(code string) bool {
+	return app.twoFactorCipher != nil && slices.Contains(app.config.twoFactor.requiredPermissions, code)
+}
+
+// rejectDelegatedAccess rejects the requests authenticated with an API key or with a
+// token issued to an OAuth client, for the resources which must only be managed by the
+// user themselves, such as the API keys.
+func (app *application) rejectDelegatedAccess(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := app.contextGetSession(r)
+		if app.contextGetAPIKey(r) != nil || (session != nil && session.ClientID != 0) {
+			app.delegatedAccessNotAllowedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
 func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Origin")
@@ -228,6 +381,27 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 	})
 }
 
+// negotiateContent picks the media type of the response from the Accept header of the
+// request, sending a 406 Not Acceptable response if none of the accepted media types
+// is supported. The negotiated encoder is then used by writeJSON.
+func (app *application) negotiateContent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+
+		encoder, ok := app.negotiateEncoder(r.Header.Get("Accept"))
+		if !ok {
+			app.notAcceptableResponse(w, r)
+			return
+		}
+
+		if encoder != nil {
+			w = &encodingResponseWriter{wrapped: w, encoder: encoder}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) metrics(next http.Handler) http.Handler {
 	var (
 		totalRequestsReceived           = expvar.NewInt("total_requests_received")
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/hayohtee/greenlight/internal/data"
+)
+
+func TestAuthenticateAPIKeyAllowedIPs(t *testing.T) {
+	app := newTestApplication(t)
+	user := insertTestUser(t, app, "pa55word1234")
+
+	key := &data.APIKey{
+		UserID:      user.ID,
+		Name:        "batch",
+		Permissions: []string{"movies:read"},
+		AllowedIPs:  []string{"10.0.0.0/8"},
+	}
+	err := app.models.APIKeys.New(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		trustedProxies []netip.Prefix
+		remoteAddr     string
+		forwardedFor   string
+		want           int
+	}{
+		{"allowed address", nil, "10.1.2.3:4321", "", http.StatusOK},
+		{"other address", nil, "203.0.113.7:4321", "", http.StatusForbidden},
+		// Anyone holding the key could claim to be in the allowlist otherwise.
+		{"spoofed X-Forwarded-For", nil, "203.0.113.7:4321", "10.1.2.3", http.StatusForbidden},
+		{"allowed address behind a trusted proxy", []netip.Prefix{netip.MustParsePrefix("192.0.2.1/32")}, "192.0.2.1:4321", "10.1.2.3", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app.config.proxies.trusted = tt.trustedProxies
+
+			handler := app.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+			r.RemoteAddr = tt.remoteAddr
+			r.Header.Set("Authorization", "ApiKey "+key.Key)
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			if rr.Code != tt.want {
+				t.Errorf("got status %d; want %d: %s", rr.Code, tt.want, rr.Body)
+			}
+		})
+	}
+}
+
+func TestRateLimitSpoofedForwardedFor(t *testing.T) {
+	var app application
+	app.config.limiter.enabled = true
+	app.config.limiter.rps = 0.001
+	app.config.limiter.burst = 1
+
+	handler := app.rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// A new X-Forwarded-For address on each request must not give the client a new
+	// limiter.
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		r := httptest.NewRequest(http.MethodGet, "/v1/healthcheck", nil)
+		r.RemoteAddr = "203.0.113.7:4321"
+		r.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i+1))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+
+		if rr.Code != want {
+			t.Errorf("got status %d for request %d; want %d", rr.Code, i+1, want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/hayohtee/greenlight/internal/data"
 	"github.com/hayohtee/greenlight/internal/validator"
+	"github.com/julienschmidt/httprouter"
 	"net/http"
 )
 
@@ -42,6 +43,8 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	app.publishEvent(data.EventMovieCreated, envelope{"movie": movie})
+
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
 
@@ -52,6 +55,14 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 }
 
 func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request) {
+	// httprouter doesn't allow the static /v1/movies/events route in the same position
+	// as /v1/movies/:id, so the event stream is served from here. Both routes require
+	// the movies:read permission.
+	if httprouter.ParamsFromContext(r.Context()).ByName("id") == "events" {
+		app.movieEventsHandler(w, r)
+		return
+	}
+
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
@@ -68,6 +79,11 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		}
 		return
 	}
+
+	if app.notModified(w, r, fmt.Sprintf(`W/"%d"`, movie.Version), movie.UpdatedAt) {
+		return
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -146,6 +162,8 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	app.publishEvent(data.EventMovieUpdated, envelope{"movie": movie})
+
 	// Write the updated movie record in a JSON response.
 	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
 	if err != nil {
@@ -174,6 +192,8 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	app.publishEvent(data.EventMovieDeleted, envelope{"movie": envelope{"id": id}})
+
 	// Return a 200 OK status code along with a success message.
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie deleted successfully"}, nil)
 	if err != nil {
@@ -205,12 +225,33 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Read the catalog version before the movies, so that a change made in between
+	// invalidates the response rather than going unnoticed.
+	catalogVersion, catalogUpdatedAt, err := app.models.Movies.CatalogVersion()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	// The list was last modified when the most recently updated movie in it was, or
+	// when the catalog last changed, which catches the movies deleted from the list.
+	lastModified := catalogUpdatedAt
+	for _, movie := range movies {
+		if movie.UpdatedAt.After(lastModified) {
+			lastModified = movie.UpdatedAt
+		}
+	}
+
+	if app.notModified(w, r, fmt.Sprintf(`W/"%d"`, catalogVersion), lastModified) {
+		return
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hayohtee/greenlight/internal/data"
+	"github.com/hayohtee/greenlight/internal/validator"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// oauthCodeTTL is how long a client has to exchange an authorization code for tokens.
+const oauthCodeTTL = 10 * time.Minute
+
+// errInvalidOAuthClient is returned when an OAuth client fails to authenticate.
+var errInvalidOAuthClient = errors.New("invalid OAuth client")
+
+func (app *application) createOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Confidential *bool    `json:"confidential"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	client := &data.OAuthClient{
+		UserID:       app.contextGetUser(r).ID,
+		Name:         input.Name,
+		RedirectURIs: input.RedirectURIs,
+		Scopes:       input.Scopes,
+		Confidential: true,
+	}
+
+	if input.Confidential != nil {
+		client.Confidential = *input.Confidential
+	}
+
+	permissionCodes, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateOAuthClient(v, client, permissionCodes); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.OAuth.InsertClient(client)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/oauth/clients/%d", client.ID))
+
+	// This is the only response which includes the client secret.
+	err = app.writeJSON(w, http.StatusCreated, envelope{"client": client}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listOAuthClientsHandler(w http.ResponseWriter, r *http.Request) {
+	clients, err := app.models.OAuth.GetClientsForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"clients": clients}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.OAuth.DeleteClient(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "client successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// authorizeOAuthClientHandler records the consent of the user to the client, and
+// returns the URI to redirect the user to, with an authorization code the client can
+// exchange for tokens. It is called by the first-party frontend once the user has
+// approved the request of the client on its consent page.
+func (app *application) authorizeOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ResponseType        string `json:"response_type"`
+		ClientID            string `json:"client_id"`
+		RedirectURI         string `json:"redirect_uri"`
+		Scope               string `json:"scope"`
+		State               string `json:"state"`
+		CodeChallenge       string `json:"code_challenge"`
+		CodeChallengeMethod string `json:"code_challenge_method"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.ResponseType == "code", "response_type", "must be code")
+	v.Check(input.ClientID != "", "client_id", "must be provided")
+	v.Check(input.RedirectURI != "", "redirect_uri", "must be provided")
+	v.Check(len(input.State) <= 500, "state", "must not be more than 500 bytes long")
+	data.ValidateCodeChallenge(v, input.CodeChallenge, input.CodeChallengeMethod)
+
+	scopes := data.ParseScope(input.Scope)
+	v.Check(len(scopes) >= 1, "scope", "must contain at least 1 scope")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	client, err := app.models.OAuth.GetClient(input.ClientID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("client_id", "unknown client")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Never redirect to a URI which wasn't registered for the client.
+	v.Check(client.AllowsRedirectURI(input.RedirectURI), "redirect_uri", "is not registered for this client")
+
+	// The user can only delegate the permissions they have, and only those the client
+	// was registered for.
+	user := app.contextGetUser(r)
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, scope := range scopes {
+		v.Check(data.Permissions(client.Scopes).Include(scope), "scope", "contains a scope the client can't request "+scope)
+		v.Check(permissions.Include(scope), "scope", "contains a permission you don't have "+scope)
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.OAuth.GrantConsent(user.ID, client.ID, scopes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	code := &data.OAuthAuthorizationCode{
+		ClientID:      client.ID,
+		UserID:        user.ID,
+		RedirectURI:   input.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: input.CodeChallenge,
+	}
+
+	err = app.models.OAuth.NewAuthorizationCode(code, oauthCodeTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	redirectURI, err := url.Parse(input.RedirectURI)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	qs := redirectURI.Query()
+	qs.Set("code", code.PlainText)
+	qs.Set("iss", app.config.oauth.issuer)
+	if input.State != "" {
+		qs.Set("state", input.State)
+	}
+	redirectURI.RawQuery = qs.Encode()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"redirect_uri": redirectURI.String()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// oauthTokenHandler is the OAuth token endpoint. It reads form-encoded requests and
+// responds with the JSON format of RFC 6749, which OAuth client libraries expect.
+func (app *application) oauthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+
+	err := r.ParseForm()
+	if err != nil {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", "the request body must be form-encoded")
+		return
+	}
+
+	client, err := app.authenticateOAuthClient(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidOAuthClient):
+			app.oauthErrorResponse(w, r, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		app.exchangeAuthorizationCode(w, r, client)
+	case "refresh_token":
+		app.exchangeOAuthRefreshToken(w, r, client)
+	case "client_credentials":
+		app.exchangeClientCredentials(w, r, client)
+	case "":
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", "grant_type must be provided")
+	default:
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "unsupported_grant_type", "the grant type is not supported")
+	}
+}
+
+// authenticateOAuthClient reads the credentials of the client from the Authorization
+// header, or else from the request body. Public clients only provide their client ID.
+func (app *application) authenticateOAuthClient(r *http.Request) (*data.OAuthClient, error) {
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		// The credentials are form-encoded before being put in the header.
+		var err1, err2 error
+		clientID, err1 = url.QueryUnescape(clientID)
+		secret, err2 = url.QueryUnescape(secret)
+		if err1 != nil || err2 != nil {
+			return nil, errInvalidOAuthClient
+		}
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	if clientID == "" {
+		return nil, errInvalidOAuthClient
+	}
+
+	client, err := app.models.OAuth.GetClient(clientID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, errInvalidOAuthClient
+		default:
+			return nil, err
+		}
+	}
+
+	if client.Confidential && !client.SecretMatches(secret) || !client.Confidential && secret != "" {
+		return nil, errInvalidOAuthClient
+	}
+
+	return client, nil
+}
+
+func (app *application) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client *data.OAuthClient) {
+	form := r.PostForm
+	if form.Get("code") == "" || form.Get("redirect_uri") == "" || form.Get("code_verifier") == "" {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", "code, redirect_uri and code_verifier must be provided")
+		return
+	}
+
+	code, err := app.models.OAuth.ConsumeAuthorizationCode(form.Get("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "invalid or expired authorization code")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if code.ClientID != client.ID || code.RedirectURI != form.Get("redirect_uri") || !data.VerifyCodeChallenge(form.Get("code_verifier"), code.CodeChallenge) {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "invalid or expired authorization code")
+		return
+	}
+
+	authenticationToken, refreshToken, err := app.models.Tokens.NewOAuthSession(
+		code.UserID,
+		client.ID,
+		code.Scopes,
+		app.config.tokens.authenticationTTL,
+		app.config.tokens.refreshTTL,
+		app.clientIP(r),
+		r.UserAgent(),
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeOAuthTokens(w, r, authenticationToken, refreshToken)
+}
+
+func (app *application) exchangeOAuthRefreshToken(w http.ResponseWriter, r *http.Request, client *data.OAuthClient) {
+	if r.PostForm.Get("refresh_token") == "" {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", "refresh_token must be provided")
+		return
+	}
+
+	rotation, err := app.models.Tokens.Rotate(
+		r.PostForm.Get("refresh_token"),
+		client.ID,
+		app.config.tokens.authenticationTTL,
+		app.config.tokens.refreshTTL,
+		app.clientIP(r),
+		r.UserAgent(),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "invalid or expired refresh token")
+		case errors.Is(err, data.ErrTokenReused):
+			// As for the first-party refresh tokens, every session of the user is revoked.
+			err = app.revokeAllSessions(rotation.UserID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "invalid or expired refresh token")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeOAuthTokens(w, r, rotation.AuthenticationToken, rotation.RefreshToken)
+}
+
+// exchangeClientCredentials issues a token for the client to act on behalf of the user
+// who registered it, restricted to the requested scopes, or all the scopes of the
+// client if none is requested.
+func (app *application) exchangeClientCredentials(w http.ResponseWriter, r *http.Request, client *data.OAuthClient) {
+	if !client.Confidential {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "unauthorized_client", "public clients can't use the client credentials grant")
+		return
+	}
+
+	scopes := client.Scopes
+	if r.PostForm.Get("scope") != "" {
+		scopes = data.ParseScope(r.PostForm.Get("scope"))
+		for _, scope := range scopes {
+			if !data.Permissions(client.Scopes).Include(scope) {
+				app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_scope", "the client can't request the scope "+scope)
+				return
+			}
+		}
+	}
+
+	token, err := app.models.Tokens.NewOAuthToken(client.UserID, client.ID, scopes, app.config.tokens.authenticationTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeOAuthTokens(w, r, token, nil)
+}
+
+// writeOAuthTokens sends the token response of RFC 6749. The refresh token is optional.
+func (app *application) writeOAuthTokens(w http.ResponseWriter, r *http.Request, authenticationToken, refreshToken *data.Token) {
+	env := envelope{
+		"access_token": authenticationToken.PlainText,
+		"token_type":   "Bearer",
+		"expires_in":   int(time.Until(authenticationToken.Expiry).Seconds()),
+		"scope":        strings.Join(authenticationToken.Scopes, " "),
+	}
+	if refreshToken != nil {
+		env["refresh_token"] = refreshToken.PlainText
+	}
+
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "no-store")
+
+	err := app.writeJSON(w, http.StatusOK, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// oauthMetadataHandler serves the authorization server metadata of RFC 8414, which
+// OAuth client libraries use to discover the endpoints.
+func (app *application) oauthMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	scopes, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	issuer := strings.TrimSuffix(app.config.oauth.issuer, "/")
+
+	env := envelope{
+		"issuer":                                         issuer,
+		"authorization_endpoint":                         fmt.Sprintf("%s/v1/oauth/authorize", issuer),
+		"token_endpoint":                                 fmt.Sprintf("%s/v1/oauth/token", issuer),
+		"scopes_supported":                               scopes,
+		"response_types_supported":                       []string{"code"},
+		"grant_types_supported":                          []string{"authorization_code", "refresh_token", "client_credentials"},
+		"token_endpoint_auth_methods_supported":          []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":               []string{"S256"},
+		"authorization_response_iss_parameter_supported": true,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listOAuthConsentsHandler(w http.ResponseWriter, r *http.Request) {
+	consents, err := app.models.OAuth.GetConsentsForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"consents": consents}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteOAuthConsentHandler revokes the access of a client to the user's account,
+// along with the tokens issued to it.
+func (app *application) deleteOAuthConsentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.OAuth.RevokeConsent(app.contextGetUser(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "access successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
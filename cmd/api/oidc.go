@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"github.com/hayohtee/greenlight/internal/data"
+	"github.com/hayohtee/greenlight/internal/oidc"
+	"github.com/hayohtee/greenlight/internal/validator"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// oidcLoginTTL is how long a user has to log in with the external provider.
+const oidcLoginTTL = 10 * time.Minute
+
+// errUnverifiedEmail is returned when the provider doesn't vouch for the email address
+// of a user who has no linked account yet.
+var errUnverifiedEmail = errors.New("unverified email address")
+
+// createOIDCAuthorizationURLHandler starts a login with the external provider,
+// returning the URL to send the user to.
+func (app *application) createOIDCAuthorizationURLHandler(w http.ResponseWriter, r *http.Request) {
+	if app.oidcProvider == nil {
+		app.oidcUnavailableResponse(w, r)
+		return
+	}
+
+	login, err := app.models.OIDC.NewLogin(oidcLoginTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	authorizationURL, err := app.oidcProvider.AuthCodeURL(r.Context(), login.State, login.Nonce, login.CodeVerifier)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authorization_url": authorizationURL}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createOIDCAuthenticationTokenHandler completes a login with the external provider,
+// exchanging the code and state the provider redirected the user with for an
+// authentication token. Two-factor authentication is left to the provider.
+func (app *application) createOIDCAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if app.oidcProvider == nil {
+		app.oidcUnavailableResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Code != "", "code", "must be provided")
+	v.Check(len(input.Code) <= 2000, "code", "must not be more than 2000 bytes long")
+	v.Check(input.State != "", "state", "must be provided")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	login, err := app.models.OIDC.ConsumeLogin(input.State)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("state", "invalid or expired login")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	claims, err := app.oidcProvider.Exchange(r.Context(), input.Code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrCodeRejected):
+			v.AddError("code", "invalid or expired authorization code")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, oidc.ErrInvalidIDToken):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.userForOIDCClaims(claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnverifiedEmail):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The provider only stands in for the password: the delays and lockouts after failed
+	// logins, and two-factor authentication, apply as to logins with a password.
+	retryAfter, failure, err := app.loginRetryAfter(user.Email, app.clientIP(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if retryAfter > 0 {
+		app.loginThrottledResponse(w, r, retryAfter)
+		return
+	}
+
+	app.completeLogin(w, r, user, failure)
+}
+
+// userForOIDCClaims returns the user linked to the account of the ID token. Accounts
+// seen for the first time are linked to the user with the same email address, which
+// the provider must have verified, and a new user is created if there is none.
+func (app *application) userForOIDCClaims(claims *oidc.Claims) (*data.User, error) {
+	issuer := app.oidcProvider.Issuer()
+
+	user, err := app.models.OIDC.GetUserForIdentity(issuer, claims.Subject)
+	if err == nil || !errors.Is(err, data.ErrRecordNotFound) {
+		return user, err
+	}
+
+	if !claims.EmailVerified || !validator.Matches(claims.Email, validator.EmailRX) {
+		return nil, errUnverifiedEmail
+	}
+
+	user, err = app.models.Users.GetByEmail(claims.Email)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		user, err = app.provisionOIDCUser(claims)
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case !user.Activated:
+		err = app.claimUnactivatedUser(user)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = app.models.OIDC.LinkIdentity(issuer, claims.Subject, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// claimUnactivatedUser activates the user on behalf of the owner of their email address,
+// which the provider verified as the activation email would have. Anyone can register
+// with an address they don't own though, so the password chosen at registration is
+// replaced with a random one, and the sessions and tokens issued before are revoked,
+// along with any deletion scheduled. The owner can set a password with a password
+// reset.
+func (app *application) claimUnactivatedUser(user *data.User) error {
+	password, err := data.RandomPassword()
+	if err != nil {
+		return err
+	}
+
+	err = user.Password.Set(password)
+	if err != nil {
+		return err
+	}
+
+	user.Activated = true
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		return err
+	}
+
+	err = app.revokeAllSessions(user.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, scope := range []string{data.ScopeActivation, data.ScopePasswordReset, data.ScopeTwoFactor} {
+		err = app.models.Tokens.DeleteAllForUser(scope, user.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = app.models.Users.CancelDeletion(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+// provisionOIDCUser creates an activated user from the claims of the ID token. The
+// user gets a random password, which they can replace with a password reset to log
+// in without the provider.
+func (app *application) provisionOIDCUser(claims *oidc.Claims) (*data.User, error) {
+	name := strings.TrimSpace(claims.Name)
+	if name == "" || len(name) > 500 {
+		name = claims.Email
+	}
+
+	user := &data.User{
+		Name:      name,
+		Email:     claims.Email,
+		Activated: true,
+	}
+
+	password, err := data.RandomPassword()
+	if err != nil {
+		return nil, err
+	}
+
+	err = user.Password.Set(password)
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.models.Users.Insert(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			// The user registered, or logged in for the first time from another
+			// request, since their email address was looked up.
+			return app.models.Users.GetByEmail(claims.Email)
+		default:
+			return nil, err
+		}
+	}
+
+	err = app.grantDefaultRole(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hayohtee/greenlight/internal/data"
+	"github.com/hayohtee/greenlight/internal/oidc"
+	"github.com/hayohtee/greenlight/internal/oidc/oidctest"
+)
+
+// newOIDCTestApplication returns an application logging in with a fake provider, see
+// newTestApplication.
+func newOIDCTestApplication(t *testing.T) (*application, *oidctest.Provider) {
+	t.Helper()
+
+	app := newTestApplication(t)
+
+	fake, err := oidctest.NewProvider("greenlight", "s3cr3t", "https://greenlight.example.com/login/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(fake.Close)
+
+	app.oidcProvider = oidc.New(fake.URL, fake.ClientID, fake.ClientSecret, fake.RedirectURI, fake.Client())
+
+	return app, fake
+}
+
+// startOIDCLogin starts a login, then logs the user in at the provider with the given
+// ID token claims, returning the code and state the provider redirected them with.
+func startOIDCLogin(t *testing.T, app *application, fake *oidctest.Provider, claims map[string]any) (string, string) {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	app.createOIDCAuthorizationURLHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/tokens/oidc/authorization", nil))
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got status %d starting the login; want %d: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+
+	var body struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	err := json.Unmarshal(rr.Body.Bytes(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state, err := fake.Authorize(body.AuthorizationURL, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code, state
+}
+
+// completeOIDCLogin exchanges the code and state for an authentication token.
+func completeOIDCLogin(t *testing.T, app *application, code, state string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	js, err := json.Marshal(map[string]string{"code": code, "state": state})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	app.createOIDCAuthenticationTokenHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/tokens/oidc", bytes.NewReader(js)))
+	return rr
+}
+
+func oidcLogin(t *testing.T, app *application, fake *oidctest.Provider, claims map[string]any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	code, state := startOIDCLogin(t, app, fake, claims)
+	return completeOIDCLogin(t, app, code, state)
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	app, fake := newOIDCTestApplication(t)
+	email := uniqueEmail(t, app)
+	subject := "new-" + email
+
+	rr := oidcLogin(t, app, fake, map[string]any{"sub": subject, "email": email, "email_verified": true, "name": "Alice"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got status %d; want %d: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+
+	user, err := app.models.OIDC.GetUserForIdentity(fake.URL, subject)
+	if err != nil {
+		t.Fatalf("the account wasn't linked: %v", err)
+	}
+	if user.Email != email || user.Name != "Alice" || !user.Activated {
+		t.Errorf("got user %+v", user)
+	}
+
+	// The account is found by its subject from then on, whatever its email address.
+	rr = oidcLogin(t, app, fake, map[string]any{"sub": subject, "email": "changed-" + email, "email_verified": true})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got status %d logging in again; want %d: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+
+	identities, err := app.models.OIDC.GetIdentitiesForUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 {
+		t.Errorf("got %d identities; want 1", len(identities))
+	}
+}
+
+func TestOIDCLoginLinksExistingUser(t *testing.T) {
+	app, fake := newOIDCTestApplication(t)
+	email := uniqueEmail(t, app)
+	subject := "existing-" + email
+
+	existing := &data.User{Name: "Bob", Email: email}
+	err := existing.Password.Set("pa55word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.models.Users.Insert(existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registrantToken, _, err := app.models.Tokens.NewSession(existing.ID, time.Hour, time.Hour, "198.18.0.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := oidcLogin(t, app, fake, map[string]any{"sub": subject, "email": email, "email_verified": true})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got status %d; want %d: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+
+	user, err := app.models.OIDC.GetUserForIdentity(fake.URL, subject)
+	if err != nil {
+		t.Fatalf("the account wasn't linked: %v", err)
+	}
+	if user.ID != existing.ID {
+		t.Errorf("got user %d; want %d", user.ID, existing.ID)
+	}
+
+	// The provider verified the email address, as the activation email would have.
+	if !user.Activated {
+		t.Error("the user wasn't activated")
+	}
+
+	// Whoever registered the account may not own the address, so their password and
+	// sessions must not work on the activated account.
+	match, err := user.Password.Matches("pa55word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match {
+		t.Error("the password chosen at registration still works")
+	}
+
+	_, _, err = app.models.Users.GetForSession(registrantToken.PlainText)
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		t.Errorf("got error %v for the session of the registrant; want %v", err, data.ErrRecordNotFound)
+	}
+}
+
+func TestOIDCLoginRequiresTwoFactor(t *testing.T) {
+	app, fake := newOIDCTestApplication(t)
+	user := insertTestUser(t, app, "pa55word1234")
+
+	err := app.models.TwoFactor.Enrol(user.ID, []byte("encrypted secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = app.models.TwoFactor.Confirm(user.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := oidcLogin(t, app, fake, map[string]any{"sub": "2fa-" + user.Email, "email": user.Email, "email_verified": true})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got status %d; want %d: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+
+	var body map[string]json.RawMessage
+	err = json.Unmarshal(rr.Body.Bytes(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := body["two_factor_token"]; !ok || body["authentication_token"] != nil {
+		t.Errorf("got %s; want a two-factor token only", rr.Body)
+	}
+}
+
+func TestOIDCLoginLockedOutAccount(t *testing.T) {
+	app, fake := newOIDCTestApplication(t)
+	app.config.login.lockoutThreshold = 1
+	user := insertTestUser(t, app, "pa55word1234")
+
+	err := app.recordLoginFailure(user.Email, uniqueIP(t, app), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := oidcLogin(t, app, fake, map[string]any{"sub": "locked-" + user.Email, "email": user.Email, "email_verified": true})
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d; want %d: %s", rr.Code, http.StatusTooManyRequests, rr.Body)
+	}
+}
+
+func TestOIDCLoginRejectsUnverifiedEmail(t *testing.T) {
+	app, fake := newOIDCTestApplication(t)
+	email := uniqueEmail(t, app)
+	subject := "unverified-" + email
+
+	existing := &data.User{Name: "Carol", Email: email, Activated: true}
+	err := existing.Password.Set("pa55word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.models.Users.Insert(existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Otherwise anyone could take over the account by claiming its email address.
+	rr := oidcLogin(t, app, fake, map[string]any{"sub": subject, "email": email, "email_verified": false})
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d; want %d: %s", rr.Code, http.StatusUnauthorized, rr.Body)
+	}
+
+	_, err = app.models.OIDC.GetUserForIdentity(fake.URL, subject)
+	if err == nil {
+		t.Error("the account was linked")
+	}
+}
+
+func TestOIDCLoginRejectsInvalidIDToken(t *testing.T) {
+	app, fake := newOIDCTestApplication(t)
+	email := uniqueEmail(t, app)
+	subject := "invalid-" + email
+
+	tests := []struct {
+		name   string
+		claims map[string]any
+	}{
+		{"wrong nonce", map[string]any{"nonce": "another-login"}},
+		{"wrong audience", map[string]any{"aud": "another-client"}},
+		{"expired", map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := map[string]any{"sub": subject, "email": email, "email_verified": true}
+			for key, value := range tt.claims {
+				claims[key] = value
+			}
+
+			rr := oidcLogin(t, app, fake, claims)
+			if rr.Code != http.StatusUnauthorized {
+				t.Fatalf("got status %d; want %d: %s", rr.Code, http.StatusUnauthorized, rr.Body)
+			}
+		})
+	}
+
+	_, err := app.models.OIDC.GetUserForIdentity(fake.URL, subject)
+	if err == nil {
+		t.Error("the account was linked")
+	}
+}
+
+func TestOIDCLoginRejectsReusedState(t *testing.T) {
+	app, fake := newOIDCTestApplication(t)
+	email := uniqueEmail(t, app)
+
+	code, state := startOIDCLogin(t, app, fake, map[string]any{"sub": "reused-" + email, "email": email, "email_verified": true})
+
+	rr := completeOIDCLogin(t, app, code, state)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got status %d; want %d: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+
+	rr = completeOIDCLogin(t, app, code, state)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d completing the login twice; want %d: %s", rr.Code, http.StatusUnprocessableEntity, rr.Body)
+	}
+}
+
+func TestOIDCLoginRejectsDeactivatedUser(t *testing.T) {
+	app, fake := newOIDCTestApplication(t)
+	email := uniqueEmail(t, app)
+	subject := "deactivated-" + email
+
+	rr := oidcLogin(t, app, fake, map[string]any{"sub": subject, "email": email, "email_verified": true})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got status %d; want %d: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+
+	user, err := app.models.OIDC.GetUserForIdentity(fake.URL, subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user.Deactivated = true
+	err = app.models.Users.Update(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The account is found by its linked identity, which must not bypass deactivation.
+	rr = oidcLogin(t, app, fake, map[string]any{"sub": subject, "email": email, "email_verified": true})
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("got status %d; want %d: %s", rr.Code, http.StatusForbidden, rr.Body)
+	}
+}
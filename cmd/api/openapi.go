@@ -0,0 +1,559 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/hayohtee/greenlight/internal/validator"
+	"github.com/julienschmidt/httprouter"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// schema is the subset of JSON Schema (as used by OpenAPI 3.1) needed to describe
+// the API, and which the request validation middleware knows how to check.
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	OneOf                []*schema          `json:"oneOf,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *int64             `json:"minimum,omitempty"`
+	Maximum              *int64             `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	UniqueItems          bool               `json:"uniqueItems,omitempty"`
+	ReadOnly             bool               `json:"readOnly,omitempty"`
+
+	// closed marks objects which reject unknown properties, like readJSON does.
+	// It is encoded as "additionalProperties": false.
+	closed bool
+}
+
+// MarshalJSON encodes the schema, adding "additionalProperties": false to closed objects.
+func (s *schema) MarshalJSON() ([]byte, error) {
+	type alias schema
+	if !s.closed {
+		return json.Marshal((*alias)(s))
+	}
+	return json.Marshal(struct {
+		*alias
+		AdditionalProperties bool `json:"additionalProperties"`
+	}{(*alias)(s), false})
+}
+
+// apiParam describes a query string parameter accepted by an operation.
+type apiParam struct {
+	name        string
+	description string
+	schema      *schema
+}
+
+// apiOperation documents a single route. Every route registered in routes() should
+// have an entry in the apiOperations table.
+type apiOperation struct {
+	summary string
+	tags    []string
+	// authenticated is set for routes wrapped in requireAuthenticatedUser.
+	authenticated bool
+	// activated is set for routes wrapped in requireActivatedUser.
+	activated bool
+	// permission is the code required by requirePermission, if any.
+	permission string
+	query      []apiParam
+	body       *schema
+	// bodyContentType overrides the media type of the request body. Bodies which aren't
+	// JSON are documented but not validated.
+	bodyContentType string
+	// status is the status code of the successful response, 200 if not set.
+	status   int
+	response *schema
+	// contentType overrides the media type of the successful response.
+	contentType string
+	// errors lists the error statuses which can't be inferred from the rest of the
+	// operation, such as 409 Conflict for edit conflicts.
+	errors []int
+}
+
+// documentedRouter wraps httprouter.Router to record the method and path of every
+// registered route, so that the OpenAPI document covers exactly the routes served.
+type documentedRouter struct {
+	*httprouter.Router
+	routes   [][2]string
+	validate bool
+	app      *application
+}
+
+// HandlerFunc registers the handler like httprouter does, wrapping it in the request
+// validation middleware when validation is enabled.
+func (dr *documentedRouter) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	dr.document(method, path)
+	if dr.validate {
+		if op, ok := apiOperations[method+" "+path]; ok {
+			handler = dr.app.validateRequest(op, handler)
+		}
+	}
+	dr.Router.HandlerFunc(method, path, handler)
+}
+
+// Handler registers the handler like httprouter does.
+func (dr *documentedRouter) Handler(method, path string, handler http.Handler) {
+	dr.document(method, path)
+	dr.Router.Handler(method, path, handler)
+}
+
+// document records the route, to be described in the OpenAPI document. Routes served by
+// the handler of another route, such as GET /v1/movies/events, are recorded directly.
+func (dr *documentedRouter) document(method, path string) {
+	dr.routes = append(dr.routes, [2]string{method, path})
+}
+
+// openAPIHandler serves the OpenAPI document describing the routes registered on the
+// router. The document is built on the first request, once every route is registered.
+func (app *application) openAPIHandler(dr *documentedRouter) http.HandlerFunc {
+	var (
+		once sync.Once
+		js   []byte
+		err  error
+	)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			js, err = json.MarshalIndent(app.openAPIDocument(dr.routes), "", "\t")
+		})
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(js)
+	}
+}
+
+// pathParamRX matches httprouter named parameters such as :id.
+var pathParamRX = regexp.MustCompile(`:([a-z_]+)`)
+
+// openAPIDocument builds the OpenAPI 3.1 document for the given routes.
+func (app *application) openAPIDocument(routes [][2]string) map[string]any {
+	paths := make(map[string]map[string]any)
+
+	for _, route := range routes {
+		method, path := route[0], route[1]
+		op, ok := apiOperations[method+" "+path]
+		if !ok {
+			op = apiOperation{summary: "Undocumented route"}
+		}
+
+		openAPIPath := pathParamRX.ReplaceAllString(path, "{$1}")
+		if paths[openAPIPath] == nil {
+			paths[openAPIPath] = make(map[string]any)
+		}
+
+		var params []map[string]any
+		for _, match := range pathParamRX.FindAllStringSubmatch(path, -1) {
+			params = append(params, map[string]any{
+				"name":     match[1],
+				"in":       "path",
+				"required": true,
+				"schema":   pathParamSchema(match[1]),
+			})
+		}
+		for _, param := range op.query {
+			params = append(params, map[string]any{
+				"name":        param.name,
+				"in":          "query",
+				"description": param.description,
+				"schema":      param.schema,
+				"style":       "form",
+				"explode":     false,
+			})
+		}
+
+		operation := map[string]any{
+			"operationId": operationID(method, path),
+			"summary":     op.summary,
+			"responses":   operationResponses(op, path),
+		}
+		if len(op.tags) > 0 {
+			operation["tags"] = op.tags
+		}
+		if params != nil {
+			operation["parameters"] = params
+		}
+		if op.body != nil {
+			bodyContentType := op.bodyContentType
+			if bodyContentType == "" {
+				bodyContentType = "application/json"
+			}
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{bodyContentType: map[string]any{"schema": op.body}},
+			}
+		}
+		if op.authenticated || op.activated || op.permission != "" {
+			operation["security"] = []map[string][]string{{"bearerAuth": {}}, {"apiKeyAuth": {}}}
+		}
+		if op.permission != "" {
+			operation["x-required-permission"] = op.permission
+			operation["description"] = fmt.Sprintf("Requires an activated user with the %s permission.", op.permission)
+		} else if op.activated {
+			operation["description"] = "Requires an activated user."
+		} else if op.authenticated {
+			operation["description"] = "Requires an authenticated user."
+		}
+
+		paths[openAPIPath][strings.ToLower(method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":       "Greenlight API",
+			"description": "A REST API for retrieving and managing information about movies. Responses can also be encoded as NDJSON, CSV or XML using the Accept header.",
+			"version":     version,
+		},
+		"servers": []map[string]string{{"url": "/"}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas":   apiSchemas,
+			"responses": apiErrorResponses(),
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]string{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "An authentication token from POST /v1/tokens/authentication, either random or a signed JWT.",
+				},
+				"apiKeyAuth": map[string]string{
+					"type":        "apiKey",
+					"in":          "header",
+					"name":        "Authorization",
+					"description": "An API key from POST /v1/users/me/api-keys, sent as \"ApiKey <key>\".",
+				},
+			},
+		},
+	}
+}
+
+// pathParamSchema returns the schema of a named path parameter. Parameters are
+// positive integer IDs, except for tokens.
+func pathParamSchema(name string) *schema {
+	if name == "token" {
+		return &schema{Type: "string", MinLength: intPtr(26), MaxLength: intPtr(26)}
+	}
+	return &schema{Type: "integer", Format: "int64", Minimum: int64Ptr(1)}
+}
+
+// operationID derives a unique operation ID from the method and path, such as
+// getV1MoviesId for GET /v1/movies/:id.
+func operationID(method, path string) string {
+	var sb strings.Builder
+	sb.WriteString(strings.ToLower(method))
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == ':' || r == '_' || r == '-' || r == '.' || r == '{' || r == '}'
+	}) {
+		sb.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return sb.String()
+}
+
+// operationResponses returns the successful and error responses for the operation.
+// The error responses are inferred from the middleware wrapping the route and the
+// helpers in errors.go, plus any listed explicitly.
+func operationResponses(op apiOperation, path string) map[string]any {
+	status := op.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	contentType := op.contentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	success := map[string]any{"description": http.StatusText(status)}
+	if op.response != nil {
+		success["content"] = map[string]any{contentType: map[string]any{"schema": op.response}}
+	}
+
+	responses := map[string]any{strconv.Itoa(status): success}
+
+	errorStatuses := append([]int{http.StatusNotAcceptable, http.StatusTooManyRequests, http.StatusInternalServerError}, op.errors...)
+	if op.body != nil {
+		errorStatuses = append(errorStatuses, http.StatusBadRequest)
+		if op.bodyContentType == "" {
+			errorStatuses = append(errorStatuses, http.StatusUnprocessableEntity)
+		}
+	}
+	if op.query != nil {
+		errorStatuses = append(errorStatuses, http.StatusUnprocessableEntity)
+	}
+	if op.activated || op.permission != "" {
+		errorStatuses = append(errorStatuses, http.StatusUnauthorized, http.StatusForbidden)
+	} else if op.authenticated {
+		errorStatuses = append(errorStatuses, http.StatusUnauthorized)
+	}
+	if strings.Contains(path, ":") {
+		errorStatuses = append(errorStatuses, http.StatusNotFound)
+	}
+
+	sort.Ints(errorStatuses)
+	for _, status := range errorStatuses {
+		if status == http.StatusNotModified {
+			responses[strconv.Itoa(status)] = map[string]string{"description": "The resource has not been modified since the copy validated by the conditional headers."}
+			continue
+		}
+		responses[strconv.Itoa(status)] = map[string]string{"$ref": "#/components/responses/" + errorResponseName(status)}
+	}
+
+	return responses
+}
+
+// errorResponseName returns the name of the shared response component for the status.
+func errorResponseName(status int) string {
+	return strings.ReplaceAll(http.StatusText(status), " ", "")
+}
+
+// apiErrorResponses describes the error responses sent by the helpers in errors.go.
+// Every error is wrapped in an envelope with an "error" key, which holds a message,
+// or a map of field names to messages for failed validations.
+func apiErrorResponses() map[string]any {
+	message := &schema{
+		Type:       "object",
+		Properties: map[string]*schema{"error": {Type: "string"}},
+		Required:   []string{"error"},
+	}
+	fields := &schema{
+		Type: "object",
+		Properties: map[string]*schema{"error": {
+			Type:                 "object",
+			AdditionalProperties: &schema{Type: "string"},
+			Description:          "A map of field names to validation error messages.",
+		}},
+		Required: []string{"error"},
+	}
+
+	descriptions := map[int]string{
+		http.StatusBadRequest:            "The request body or query string is malformed.",
+		http.StatusUnauthorized:          "The authentication token is missing, invalid or expired, or the credentials are invalid.",
+		http.StatusForbidden:             "The account is not activated, has been deactivated, lacks the required permission or hasn't enabled the two-factor authentication it requires.",
+		http.StatusNotFound:              "The requested resource could not be found.",
+		http.StatusMethodNotAllowed:      "The method is not supported for this resource.",
+		http.StatusNotAcceptable:         "None of the media types in the Accept header can be produced.",
+		http.StatusConflict:              "The record was modified concurrently, please try again.",
+		http.StatusUnprocessableEntity:   "The request failed validation.",
+		http.StatusTooManyRequests:       "The client exceeded the rate limit.",
+		http.StatusInternalServerError:   "The server encountered a problem and could not process the request.",
+		http.StatusServiceUnavailable:    "The service is temporarily unavailable.",
+		http.StatusRequestEntityTooLarge: "The request body is too large.",
+	}
+
+	responses := make(map[string]any)
+	for status, description := range descriptions {
+		s := message
+		if status == http.StatusUnprocessableEntity {
+			s = fields
+		}
+		responses[errorResponseName(status)] = map[string]any{
+			"description": description,
+			"content":     map[string]any{"application/json": map[string]any{"schema": s}},
+		}
+	}
+	return responses
+}
+
+// validateRequest is a middleware which checks the query string and JSON body of the
+// request against the operation schemas, sending a 422 Unprocessable Entity response
+// listing the mismatches. It is only enabled in development, to catch clients and
+// handlers drifting away from the OpenAPI document.
+func (app *application) validateRequest(op apiOperation, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		errs := make(map[string]string)
+
+		qs := r.URL.Query()
+		for _, param := range op.query {
+			if !qs.Has(param.name) {
+				continue
+			}
+
+			var value any = qs.Get(param.name)
+			switch param.schema.Type {
+			case "integer":
+				value = json.Number(qs.Get(param.name))
+			case "array":
+				var items []any
+				for _, item := range strings.Split(qs.Get(param.name), ",") {
+					items = append(items, item)
+				}
+				value = items
+			}
+			param.schema.check(value, param.name, errs)
+		}
+
+		if op.body != nil && op.bodyContentType == "" && r.Body != nil {
+			body, err := io.ReadAll(io.LimitReader(r.Body, 1_048_576+1))
+			if err != nil {
+				app.badRequestResponse(w, r, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			// Leave malformed bodies for readJSON to report.
+			dec := json.NewDecoder(bytes.NewReader(body))
+			dec.UseNumber()
+
+			var value any
+			if dec.Decode(&value) == nil {
+				op.body.check(value, "", errs)
+			}
+		}
+
+		if len(errs) > 0 {
+			app.failedValidationResponse(w, r, errs)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// check validates the value, as decoded by encoding/json with UseNumber, against the
+// schema, adding an error message keyed by the path of each mismatching value.
+func (s *schema) check(value any, path string, errs map[string]string) {
+	if s.Ref != "" {
+		apiSchemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")].check(value, path, errs)
+		return
+	}
+
+	key := path
+	if key == "" {
+		key = "body"
+	}
+
+	fail := func(format string, args ...any) {
+		if _, exists := errs[key]; !exists {
+			errs[key] = fmt.Sprintf(format, args...)
+		}
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			fail("must be an object")
+			return
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				errs[joinPath(path, name)] = "must be provided"
+			}
+		}
+		for name, v := range obj {
+			prop, ok := s.Properties[name]
+			switch {
+			case ok:
+				prop.check(v, joinPath(path, name), errs)
+			case s.AdditionalProperties != nil:
+				s.AdditionalProperties.check(v, joinPath(path, name), errs)
+			case s.closed:
+				errs[joinPath(path, name)] = "is not a known field"
+			}
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			fail("must be an array")
+			return
+		}
+		if s.MinItems != nil && len(items) < *s.MinItems {
+			fail("must contain at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(items) > *s.MaxItems {
+			fail("must not contain more than %d items", *s.MaxItems)
+		}
+		if s.UniqueItems {
+			seen := make(map[string]bool)
+			for _, item := range items {
+				js, _ := json.Marshal(item)
+				if seen[string(js)] {
+					fail("must not contain duplicate values")
+				}
+				seen[string(js)] = true
+			}
+		}
+		if s.Items != nil {
+			for i, item := range items {
+				s.Items.check(item, fmt.Sprintf("%s[%d]", key, i), errs)
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			fail("must be a string")
+			return
+		}
+		if s.MinLength != nil && len(str) < *s.MinLength {
+			fail("must be at least %d bytes long", *s.MinLength)
+		}
+		if s.MaxLength != nil && len(str) > *s.MaxLength {
+			fail("must not be more than %d bytes long", *s.MaxLength)
+		}
+		if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(str) {
+			fail("must match the pattern %s", s.Pattern)
+		}
+		if s.Enum != nil && !validator.PermittedValue(str, s.Enum...) {
+			fail("must be one of %s", strings.Join(s.Enum, ", "))
+		}
+	case "integer":
+		num, ok := value.(json.Number)
+		if !ok {
+			fail("must be an integer")
+			return
+		}
+		i, err := num.Int64()
+		if err != nil {
+			fail("must be an integer")
+			return
+		}
+		if s.Minimum != nil && i < *s.Minimum {
+			fail("must be greater or equal to %d", *s.Minimum)
+		}
+		if s.Maximum != nil && i > *s.Maximum {
+			fail("must be less or equal to %d", *s.Maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("must be a boolean")
+		}
+	}
+}
+
+// joinPath returns the path of the named property of the value at path.
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
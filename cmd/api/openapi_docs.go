@@ -0,0 +1,990 @@
+package main
+
+import (
+	"github.com/hayohtee/greenlight/internal/data"
+	"net/http"
+)
+
+// Helpers for building the schemas below.
+
+func ref(name string) *schema {
+	return &schema{Ref: "#/components/schemas/" + name}
+}
+
+func object(properties map[string]*schema, required ...string) *schema {
+	return &schema{Type: "object", Properties: properties, Required: required}
+}
+
+// closedObject returns a closed object schema, for request bodies decoded by readJSON.
+func closedObject(properties map[string]*schema, required ...string) *schema {
+	s := object(properties, required...)
+	s.closed = true
+	return s
+}
+
+// envelopeOf returns the schema of a response wrapping the value in the named key.
+func envelopeOf(key string, value *schema) *schema {
+	return object(map[string]*schema{key: value}, key)
+}
+
+func arrayOf(items *schema) *schema {
+	return &schema{Type: "array", Items: items}
+}
+
+func str(minLength, maxLength int) *schema {
+	s := &schema{Type: "string"}
+	if minLength > 0 {
+		s.MinLength = intPtr(minLength)
+	}
+	if maxLength > 0 {
+		s.MaxLength = intPtr(maxLength)
+	}
+	return s
+}
+
+func integer(minimum, maximum int64) *schema {
+	return &schema{Type: "integer", Minimum: int64Ptr(minimum), Maximum: int64Ptr(maximum)}
+}
+
+func idSchema() *schema {
+	return &schema{Type: "integer", Format: "int64", Minimum: int64Ptr(1), ReadOnly: true}
+}
+
+func boolean() *schema {
+	return &schema{Type: "boolean"}
+}
+
+func dateTime() *schema {
+	return &schema{Type: "string", Format: "date-time", ReadOnly: true}
+}
+
+func enum(values ...string) *schema {
+	return &schema{Type: "string", Enum: values}
+}
+
+func emailSchema() *schema {
+	return &schema{Type: "string", Format: "email", Pattern: `^[^@\s]+@[^@\s]+$`}
+}
+
+func passwordSchema() *schema {
+	return &schema{Type: "string", Format: "password", MinLength: intPtr(8), MaxLength: intPtr(72)}
+}
+
+// newPasswordSchema returns the schema of a password being chosen, which must also
+// follow the password policy.
+func newPasswordSchema() *schema {
+	s := passwordSchema()
+	s.Description = "Must be hard enough to guess, not contain the name or email address of the user, and not have appeared in a known data breach."
+	return s
+}
+
+func tokenSchema() *schema {
+	return str(26, 26)
+}
+
+func runtimeSchema() *schema {
+	return &schema{Type: "string", Pattern: `^\d+ mins$`, Description: `The runtime in minutes, formatted as "<runtime> mins".`}
+}
+
+func genresSchema() *schema {
+	return &schema{Type: "array", Items: str(1, 0), MinItems: intPtr(1), MaxItems: intPtr(5), UniqueItems: true}
+}
+
+func messageSchema() *schema {
+	return envelopeOf("message", &schema{Type: "string"})
+}
+
+// userAccessSchema returns the schema of the roles of a user along with their
+// effective permissions.
+func userAccessSchema() *schema {
+	return object(map[string]*schema{
+		"roles":       arrayOf(&schema{Type: "string"}),
+		"permissions": arrayOf(&schema{Type: "string", Description: "The permissions granted directly or through a role."}),
+	}, "roles", "permissions")
+}
+
+// twoFactorCodeSchema returns the schema of a code from an authenticator app or a
+// recovery code.
+func twoFactorCodeSchema() *schema {
+	return &schema{Type: "string", Description: "A 6 digits code from the authenticator app, or a recovery code."}
+}
+
+// tokenPair returns the schema of a response holding new authentication and refresh tokens.
+func tokenPair() *schema {
+	return object(map[string]*schema{
+		"authentication_token": ref("Token"),
+		"refresh_token":        ref("Token"),
+	}, "authentication_token", "refresh_token")
+}
+
+// paginated returns the schema of a paginated list response.
+func paginated(key, item string) *schema {
+	return object(map[string]*schema{key: arrayOf(ref(item)), "metadata": ref("Metadata")}, key, "metadata")
+}
+
+// paginationParams returns the query parameters accepted by ValidateFilters.
+func paginationParams(sortSafeList ...string) []apiParam {
+	return []apiParam{
+		{name: "page", description: "The page number.", schema: integer(1, 10_000_000)},
+		{name: "page_size", description: "The number of records per page.", schema: integer(1, 100)},
+		{name: "sort", description: "The field to sort on, prefixed with - for descending order.", schema: enum(sortSafeList...)},
+	}
+}
+
+// apiSchemas holds the schemas of the resources returned by the API.
+var apiSchemas = map[string]*schema{
+	"Movie": object(map[string]*schema{
+		"id":      idSchema(),
+		"title":   str(1, 500),
+		"year":    integer(1888, 9999),
+		"runtime": runtimeSchema(),
+		"genres":  genresSchema(),
+		"version": {Type: "integer", ReadOnly: true},
+	}, "id", "title", "version"),
+	"Metadata": object(map[string]*schema{
+		"current_page":  {Type: "integer"},
+		"page_size":     {Type: "integer"},
+		"first_page":    {Type: "integer"},
+		"last_page":     {Type: "integer"},
+		"total_records": {Type: "integer"},
+	}),
+	"User": object(map[string]*schema{
+		"id":          idSchema(),
+		"created_at":  dateTime(),
+		"name":        str(1, 500),
+		"email":       emailSchema(),
+		"activated":   boolean(),
+		"deactivated": {Type: "boolean", ReadOnly: true, Description: "Whether an administrator deactivated the account."},
+	}, "id", "created_at", "name", "email", "activated", "deactivated"),
+	"Token": object(map[string]*schema{
+		"token": {
+			Type:        "string",
+			Description: "A random 26 characters token, or a signed JWT for authentication tokens when the server issues signed tokens.",
+		},
+		"expiry": dateTime(),
+	}, "token", "expiry"),
+	"MovieStats": object(map[string]*schema{
+		"total_movies": {Type: "integer"},
+		"genres": arrayOf(object(map[string]*schema{
+			"genre": {Type: "string"},
+			"total": {Type: "integer"},
+		}, "genre", "total")),
+		"years": arrayOf(object(map[string]*schema{
+			"year":  {Type: "integer"},
+			"total": {Type: "integer"},
+		}, "year", "total")),
+		"runtime_percentiles": object(map[string]*schema{
+			"p25": runtimeSchema(),
+			"p50": runtimeSchema(),
+			"p75": runtimeSchema(),
+			"p90": runtimeSchema(),
+			"p99": runtimeSchema(),
+		}),
+		"added_per_week": arrayOf(object(map[string]*schema{
+			"week":  dateTime(),
+			"total": {Type: "integer"},
+		}, "week", "total")),
+		"refreshed_at": dateTime(),
+	}, "total_movies", "genres", "years", "runtime_percentiles", "added_per_week", "refreshed_at"),
+	"List": object(map[string]*schema{
+		"id":          idSchema(),
+		"created_at":  dateTime(),
+		"name":        str(1, 500),
+		"description": str(0, 2000),
+		"visibility":  enum(data.ListVisibilityPrivate, data.ListVisibilityUnlisted, data.ListVisibilityPublic),
+		"share_token": {Type: "string", Description: "Only included for the owner of the list."},
+		"items":       arrayOf(ref("ListItem")),
+		"version":     {Type: "integer", ReadOnly: true},
+	}, "id", "created_at", "name", "visibility", "version"),
+	"ListItem": object(map[string]*schema{
+		"movie_id": {Type: "integer", Format: "int64"},
+		"title":    {Type: "string"},
+		"year":     {Type: "integer"},
+		"position": {Type: "integer", Minimum: int64Ptr(1)},
+		"notes":    str(0, 2000),
+		"added_at": dateTime(),
+	}, "movie_id", "title", "position", "added_at"),
+	"Webhook": object(map[string]*schema{
+		"id":         idSchema(),
+		"created_at": dateTime(),
+		"url":        {Type: "string", Format: "uri"},
+		"events":     arrayOf(enum(data.WebhookEvents...)),
+		"secret":     {Type: "string", Description: "Only included when the webhook is created."},
+		"active":     boolean(),
+		"version":    {Type: "integer", ReadOnly: true},
+	}, "id", "created_at", "url", "events", "active", "version"),
+	"APIKey": object(map[string]*schema{
+		"id":           idSchema(),
+		"created_at":   dateTime(),
+		"name":         {Type: "string"},
+		"key":          {Type: "string", Description: "Only included when the key is created or rotated."},
+		"prefix":       {Type: "string", Description: "The start of the key, to identify it."},
+		"permissions":  arrayOf(&schema{Type: "string"}),
+		"allowed_ips":  arrayOf(&schema{Type: "string", Description: "An IP address or CIDR block."}),
+		"last_used_at": dateTime(),
+	}, "id", "created_at", "name", "prefix", "permissions", "allowed_ips"),
+	"OAuthClient": object(map[string]*schema{
+		"id":            idSchema(),
+		"created_at":    dateTime(),
+		"client_id":     {Type: "string"},
+		"client_secret": {Type: "string", Description: "Only included when a confidential client is created."},
+		"name":          {Type: "string"},
+		"redirect_uris": arrayOf(&schema{Type: "string", Format: "uri"}),
+		"scopes":        arrayOf(&schema{Type: "string"}),
+		"confidential":  boolean(),
+	}, "id", "created_at", "client_id", "name", "redirect_uris", "scopes", "confidential"),
+	"OAuthConsent": object(map[string]*schema{
+		"client_id":   {Type: "integer", Format: "int64", Description: "The ID of the OAuth client."},
+		"client_name": {Type: "string"},
+		"scopes":      arrayOf(&schema{Type: "string"}),
+		"created_at":  dateTime(),
+		"updated_at":  dateTime(),
+	}, "client_id", "client_name", "scopes", "created_at", "updated_at"),
+	"WebhookDelivery": object(map[string]*schema{
+		"id":              idSchema(),
+		"created_at":      dateTime(),
+		"webhook_id":      {Type: "integer", Format: "int64"},
+		"event":           enum(data.WebhookEvents...),
+		"payload":         {Type: "object"},
+		"status":          enum(data.DeliveryStatusPending, data.DeliveryStatusSucceeded, data.DeliveryStatusFailed),
+		"attempts":        {Type: "integer"},
+		"next_attempt_at": dateTime(),
+		"last_attempt_at": dateTime(),
+		"response_status": {Type: "integer"},
+		"last_error":      {Type: "string"},
+	}, "id", "created_at", "webhook_id", "event", "payload", "status", "attempts", "next_attempt_at"),
+	"Role": object(map[string]*schema{
+		"id":          idSchema(),
+		"created_at":  dateTime(),
+		"name":        {Type: "string", Pattern: data.RoleNameRX.String(), MaxLength: intPtr(100)},
+		"description": str(0, 2000),
+		"permissions": arrayOf(&schema{Type: "string"}),
+		"version":     {Type: "integer", ReadOnly: true},
+	}, "id", "created_at", "name", "permissions", "version"),
+	"Session": object(map[string]*schema{
+		"id":           idSchema(),
+		"created_at":   dateTime(),
+		"last_used_at": dateTime(),
+		"expiry":       dateTime(),
+		"ip":           {Type: "string"},
+		"user_agent":   {Type: "string"},
+		"current":      {Type: "boolean", Description: "Whether this is the session of the token used by the request."},
+		"oauth_client_id": {
+			Type:        "integer",
+			Format:      "int64",
+			Description: "The OAuth client the session was issued to, for sessions granted to an application.",
+		},
+		"scopes": arrayOf(&schema{Type: "string", Description: "The permissions granted to the OAuth client."}),
+	}, "id", "created_at", "expiry", "ip", "user_agent", "current"),
+	"MovieEvent": object(map[string]*schema{
+		"id":         idSchema(),
+		"created_at": dateTime(),
+		"event":      enum(data.EventMovieCreated, data.EventMovieUpdated, data.EventMovieDeleted),
+		"movie_id":   {Type: "integer", Format: "int64"},
+		"movie":      ref("Movie"),
+	}, "id", "created_at", "event", "movie_id"),
+}
+
+// apiOperations documents every route, keyed by method and path as registered in routes().
+var apiOperations = map[string]apiOperation{
+	"GET /v1/healthcheck": {
+		summary: "Show application health and version information",
+		tags:    []string{"system"},
+		response: object(map[string]*schema{
+			"status": {Type: "string"},
+			"system_info": object(map[string]*schema{
+				"environment": {Type: "string"},
+				"version":     {Type: "string"},
+			}),
+		}),
+	},
+	"GET /v1/openapi.json": {
+		summary:  "Show this OpenAPI document",
+		tags:     []string{"system"},
+		response: &schema{Type: "object"},
+	},
+	"GET /debug/vars": {
+		summary:  "Display application metrics",
+		tags:     []string{"system"},
+		response: &schema{Type: "object"},
+	},
+
+	"GET /v1/movies": {
+		summary:    "Show the details of all movies",
+		tags:       []string{"movies"},
+		permission: "movies:read",
+		query: append([]apiParam{
+			{name: "title", description: "Full-text search on the movie title.", schema: str(0, 0)},
+			{name: "genres", description: "Comma-separated genres the movies must all have.", schema: arrayOf(str(1, 0))},
+		}, paginationParams("id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime")...),
+		response: paginated("movies", "Movie"),
+		errors:   []int{http.StatusNotModified},
+	},
+	"POST /v1/movies": {
+		summary:    "Create a new movie",
+		tags:       []string{"movies"},
+		permission: "movies:write",
+		body: closedObject(map[string]*schema{
+			"title":   str(1, 500),
+			"year":    integer(1888, 9999),
+			"runtime": runtimeSchema(),
+			"genres":  genresSchema(),
+		}, "title", "year", "runtime", "genres"),
+		status:   http.StatusCreated,
+		response: envelopeOf("movie", ref("Movie")),
+	},
+	"GET /v1/movies/events": {
+		summary:     "Stream changes to movies as Server-Sent Events",
+		tags:        []string{"movies"},
+		permission:  "movies:read",
+		contentType: "text/event-stream",
+		response: &schema{
+			Type:        "string",
+			Description: "A stream of events named after the change, with the event ID as id and a MovieEvent as data. Send the Last-Event-ID header to resume a stream.",
+		},
+		errors: []int{http.StatusBadRequest},
+	},
+	"GET /v1/movies/:id": {
+		summary:    "Show the details of a specific movie",
+		tags:       []string{"movies"},
+		permission: "movies:read",
+		response:   envelopeOf("movie", ref("Movie")),
+		errors:     []int{http.StatusNotModified},
+	},
+	"PATCH /v1/movies/:id": {
+		summary:    "Update the details of a specific movie",
+		tags:       []string{"movies"},
+		permission: "movies:write",
+		body: closedObject(map[string]*schema{
+			"title":   str(1, 500),
+			"year":    integer(1888, 9999),
+			"runtime": runtimeSchema(),
+			"genres":  genresSchema(),
+		}),
+		response: envelopeOf("movie", ref("Movie")),
+		errors:   []int{http.StatusConflict},
+	},
+	"DELETE /v1/movies/:id": {
+		summary:    "Delete a specific movie",
+		tags:       []string{"movies"},
+		permission: "movies:write",
+		response:   messageSchema(),
+	},
+
+	"GET /v1/stats/movies": {
+		summary:    "Show statistics about the movie catalog",
+		tags:       []string{"stats"},
+		permission: "movies:read",
+		query: []apiParam{
+			{name: "weeks", description: "The number of recent weeks to count added movies for.", schema: integer(1, 520)},
+		},
+		response: envelopeOf("stats", ref("MovieStats")),
+	},
+	"POST /v1/stats/movies/refresh": {
+		summary:    "Recompute the movie catalog statistics",
+		tags:       []string{"stats"},
+		permission: "stats:refresh",
+		response:   envelopeOf("stats", ref("MovieStats")),
+	},
+
+	"GET /v1/lists": {
+		summary:   "Show the lists owned by the authenticated user",
+		tags:      []string{"lists"},
+		activated: true,
+		query:     paginationParams("id", "name", "created_at", "-id", "-name", "-created_at"),
+		response:  paginated("lists", "List"),
+	},
+	"POST /v1/lists": {
+		summary:   "Create a new list",
+		tags:      []string{"lists"},
+		activated: true,
+		body: closedObject(map[string]*schema{
+			"name":        str(1, 500),
+			"description": str(0, 2000),
+			"visibility":  enum(data.ListVisibilityPrivate, data.ListVisibilityUnlisted, data.ListVisibilityPublic),
+		}, "name"),
+		status:   http.StatusCreated,
+		response: envelopeOf("list", ref("List")),
+	},
+	"GET /v1/lists/:id": {
+		summary:  "Show the details and items of a specific list. Anonymous users can only see public lists.",
+		tags:     []string{"lists"},
+		response: envelopeOf("list", ref("List")),
+	},
+	"PATCH /v1/lists/:id": {
+		summary:   "Update the details of a specific list",
+		tags:      []string{"lists"},
+		activated: true,
+		body: closedObject(map[string]*schema{
+			"name":                   str(1, 500),
+			"description":            str(0, 2000),
+			"visibility":             enum(data.ListVisibilityPrivate, data.ListVisibilityUnlisted, data.ListVisibilityPublic),
+			"regenerate_share_token": boolean(),
+		}),
+		response: envelopeOf("list", ref("List")),
+		errors:   []int{http.StatusConflict},
+	},
+	"DELETE /v1/lists/:id": {
+		summary:   "Delete a specific list",
+		tags:      []string{"lists"},
+		activated: true,
+		response:  messageSchema(),
+	},
+	"POST /v1/lists/:id/items": {
+		summary:   "Add a movie to a specific list",
+		tags:      []string{"lists"},
+		activated: true,
+		body: closedObject(map[string]*schema{
+			"movie_id": {Type: "integer", Format: "int64", Minimum: int64Ptr(1)},
+			"position": {Type: "integer", Minimum: int64Ptr(0), Description: "Zero or omitted to append the movie to the list."},
+			"notes":    str(0, 2000),
+		}, "movie_id"),
+		status:   http.StatusCreated,
+		response: envelopeOf("item", ref("ListItem")),
+	},
+	"PATCH /v1/lists/:id/items/:movie_id": {
+		summary:   "Update the position or notes of a movie in a list",
+		tags:      []string{"lists"},
+		activated: true,
+		body: closedObject(map[string]*schema{
+			"position": {Type: "integer", Minimum: int64Ptr(0)},
+			"notes":    str(0, 2000),
+		}),
+		response: envelopeOf("item", ref("ListItem")),
+	},
+	"DELETE /v1/lists/:id/items/:movie_id": {
+		summary:   "Remove a movie from a list",
+		tags:      []string{"lists"},
+		activated: true,
+		response:  messageSchema(),
+	},
+	"GET /v1/shared/lists/:token": {
+		summary:  "Show a public or unlisted list using its share token",
+		tags:     []string{"lists"},
+		response: envelopeOf("list", ref("List")),
+	},
+
+	"GET /v1/webhooks": {
+		summary:    "Show the webhooks owned by the authenticated user",
+		tags:       []string{"webhooks"},
+		permission: "webhooks:write",
+		query:      paginationParams("id", "url", "created_at", "-id", "-url", "-created_at"),
+		response:   paginated("webhooks", "Webhook"),
+	},
+	"POST /v1/webhooks": {
+		summary:    "Subscribe a new webhook to movie and user events",
+		tags:       []string{"webhooks"},
+		permission: "webhooks:write",
+		body: closedObject(map[string]*schema{
+			"url":    {Type: "string", Format: "uri", MaxLength: intPtr(2000)},
+			"events": {Type: "array", Items: enum(data.WebhookEvents...), MinItems: intPtr(1), UniqueItems: true},
+			"secret": str(16, 200),
+		}, "url", "events"),
+		status:   http.StatusCreated,
+		response: envelopeOf("webhook", ref("Webhook")),
+	},
+	"GET /v1/webhooks/:id": {
+		summary:    "Show the details of a specific webhook",
+		tags:       []string{"webhooks"},
+		permission: "webhooks:write",
+		response:   envelopeOf("webhook", ref("Webhook")),
+	},
+	"PATCH /v1/webhooks/:id": {
+		summary:    "Update the details of a specific webhook",
+		tags:       []string{"webhooks"},
+		permission: "webhooks:write",
+		body: closedObject(map[string]*schema{
+			"url":    {Type: "string", Format: "uri", MaxLength: intPtr(2000)},
+			"events": {Type: "array", Items: enum(data.WebhookEvents...), MinItems: intPtr(1), UniqueItems: true},
+			"secret": str(16, 200),
+			"active": boolean(),
+		}),
+		response: envelopeOf("webhook", ref("Webhook")),
+		errors:   []int{http.StatusConflict},
+	},
+	"DELETE /v1/webhooks/:id": {
+		summary:    "Delete a specific webhook",
+		tags:       []string{"webhooks"},
+		permission: "webhooks:write",
+		response:   messageSchema(),
+	},
+	"GET /v1/webhooks/:id/deliveries": {
+		summary:    "Show the delivery log of a specific webhook",
+		tags:       []string{"webhooks"},
+		permission: "webhooks:write",
+		query: append([]apiParam{
+			{name: "status", description: "Only show deliveries with this status.", schema: enum(data.DeliveryStatusPending, data.DeliveryStatusSucceeded, data.DeliveryStatusFailed)},
+		}, paginationParams("id", "created_at", "attempts", "-id", "-created_at", "-attempts")...),
+		response: paginated("deliveries", "WebhookDelivery"),
+	},
+
+	"POST /v1/users": {
+		summary: "Register a new user",
+		tags:    []string{"users"},
+		body: closedObject(map[string]*schema{
+			"name":     str(1, 500),
+			"email":    emailSchema(),
+			"password": newPasswordSchema(),
+		}, "name", "email", "password"),
+		status:   http.StatusCreated,
+		response: envelopeOf("user", ref("User")),
+	},
+	"PUT /v1/users/activated": {
+		summary:  "Activate a specific user",
+		tags:     []string{"users"},
+		body:     closedObject(map[string]*schema{"token": tokenSchema()}, "token"),
+		response: envelopeOf("user", ref("User")),
+		errors:   []int{http.StatusConflict},
+	},
+	"PUT /v1/users/password": {
+		summary: "Reset the password of a user using a password reset token",
+		tags:    []string{"users"},
+		body: closedObject(map[string]*schema{
+			"password": newPasswordSchema(),
+			"token":    tokenSchema(),
+		}, "password", "token"),
+		response: messageSchema(),
+		errors:   []int{http.StatusConflict},
+	},
+
+	"PUT /v1/users/email": {
+		summary:  "Confirm the new email address of a user using the token sent to it",
+		tags:     []string{"users"},
+		body:     closedObject(map[string]*schema{"token": tokenSchema()}, "token"),
+		response: envelopeOf("user", ref("User")),
+		errors:   []int{http.StatusConflict},
+	},
+	"GET /v1/users/me": {
+		summary:       "Show the authenticated user, with the date of their deletion if one is scheduled",
+		tags:          []string{"users"},
+		authenticated: true,
+		response: object(map[string]*schema{
+			"user":                  ref("User"),
+			"deletion_scheduled_at": dateTime(),
+		}, "user"),
+	},
+	"PATCH /v1/users/me": {
+		summary:   "Update the name or the password of the authenticated user, changing the password logs out their other sessions. Invalid current passwords count as failed logins.",
+		tags:      []string{"users"},
+		activated: true,
+		body: closedObject(map[string]*schema{
+			"name":             str(1, 500),
+			"password":         newPasswordSchema(),
+			"current_password": {Type: "string", Format: "password", Description: "The current password of the user, required to change the password."},
+		}),
+		response: envelopeOf("user", ref("User")),
+		errors:   []int{http.StatusConflict},
+	},
+	"DELETE /v1/users/me": {
+		summary:       "Schedule the deletion of the authenticated user at the end of the grace period, logging them out everywhere and suspending their API keys and OAuth clients. Invalid passwords count as failed logins.",
+		tags:          []string{"users"},
+		authenticated: true,
+		body: closedObject(map[string]*schema{
+			"password": {Type: "string", Format: "password", Description: "The current password of the user."},
+		}, "password"),
+		status: http.StatusAccepted,
+		response: object(map[string]*schema{
+			"message":               {Type: "string"},
+			"deletion_scheduled_at": dateTime(),
+		}, "message", "deletion_scheduled_at"),
+	},
+	"DELETE /v1/users/me/deletion": {
+		summary:       "Cancel the scheduled deletion of the authenticated user",
+		tags:          []string{"users"},
+		authenticated: true,
+		response:      messageSchema(),
+		errors:        []int{http.StatusNotFound},
+	},
+	"GET /v1/users/me/export": {
+		summary:       "Export everything held about the authenticated user as a JSON archive",
+		tags:          []string{"users"},
+		authenticated: true,
+		response: object(map[string]*schema{
+			"exported_at":        dateTime(),
+			"user":               ref("User"),
+			"permissions":        arrayOf(&schema{Type: "string"}),
+			"two_factor_enabled": boolean(),
+			"sessions":           arrayOf(ref("Session")),
+			"api_keys":           arrayOf(ref("APIKey")),
+			"oauth_clients":      arrayOf(ref("OAuthClient")),
+			"oauth_consents":     arrayOf(ref("OAuthConsent")),
+			"identities": arrayOf(object(map[string]*schema{
+				"issuer":     {Type: "string", Description: "The OpenID Connect provider."},
+				"subject":    {Type: "string", Description: "The ID of the account with the provider."},
+				"created_at": dateTime(),
+			}, "issuer", "subject", "created_at")),
+			"lists":                 arrayOf(ref("List")),
+			"webhooks":              arrayOf(ref("Webhook")),
+			"pending_email":         {Type: "string", Format: "email", Description: "The email address waiting for confirmation, if any."},
+			"deletion_scheduled_at": dateTime(),
+		}, "exported_at", "user", "roles", "permissions", "two_factor_enabled", "sessions", "api_keys", "oauth_clients", "oauth_consents", "identities", "lists", "webhooks"),
+	},
+	"PATCH /v1/users/me/email": {
+		summary:   "Change the email address of the authenticated user, which takes effect once confirmed from the new address. Invalid passwords count as failed logins.",
+		tags:      []string{"users"},
+		activated: true,
+		body: closedObject(map[string]*schema{
+			"email":    emailSchema(),
+			"password": {Type: "string", Format: "password", Description: "The current password of the user."},
+		}, "email", "password"),
+		status:   http.StatusAccepted,
+		response: messageSchema(),
+	},
+	"GET /v1/users/me/sessions": {
+		summary:       "Show the active sessions of the authenticated user",
+		tags:          []string{"users"},
+		authenticated: true,
+		response:      envelopeOf("sessions", arrayOf(ref("Session"))),
+	},
+	"DELETE /v1/users/me/sessions": {
+		summary:       "Revoke every session of the authenticated user, logging them out everywhere",
+		tags:          []string{"users"},
+		authenticated: true,
+		response:      messageSchema(),
+	},
+	"DELETE /v1/users/me/sessions/:id": {
+		summary:       "Revoke a specific session of the authenticated user",
+		tags:          []string{"users"},
+		authenticated: true,
+		response:      messageSchema(),
+	},
+	"POST /v1/users/me/2fa": {
+		summary:   "Start enabling two-factor authentication, returning the TOTP secret to add to an authenticator app",
+		tags:      []string{"users"},
+		activated: true,
+		status:    http.StatusCreated,
+		response: envelopeOf("two_factor", object(map[string]*schema{
+			"secret":      {Type: "string"},
+			"otpauth_uri": {Type: "string", Format: "uri"},
+		}, "secret", "otpauth_uri")),
+		errors: []int{http.StatusServiceUnavailable},
+	},
+	"PUT /v1/users/me/2fa/confirmed": {
+		summary:   "Enable two-factor authentication with a first code from the authenticator app, returning single-use recovery codes",
+		tags:      []string{"users"},
+		activated: true,
+		body:      closedObject(map[string]*schema{"code": {Type: "string", Pattern: `^[0-9]{6}$`}}, "code"),
+		response:  envelopeOf("recovery_codes", arrayOf(&schema{Type: "string"})),
+		errors:    []int{http.StatusConflict, http.StatusServiceUnavailable},
+	},
+	"DELETE /v1/users/me/2fa": {
+		summary:   "Disable two-factor authentication with the password and a code from the authenticator app or a recovery code. Invalid passwords and codes count as failed logins, and the session is revoked after too many invalid codes.",
+		tags:      []string{"users"},
+		activated: true,
+		body: closedObject(map[string]*schema{
+			"password": {Type: "string", Format: "password", Description: "The current password of the user."},
+			"code":     twoFactorCodeSchema(),
+		}, "password", "code"),
+		response: messageSchema(),
+		errors:   []int{http.StatusNotFound},
+	},
+	"GET /v1/users/me/api-keys": {
+		summary:   "Show the API keys of the authenticated user. Not available with an API key.",
+		tags:      []string{"users"},
+		activated: true,
+		response:  envelopeOf("api_keys", arrayOf(ref("APIKey"))),
+	},
+	"POST /v1/users/me/api-keys": {
+		summary:   "Create an API key restricted to some of the user's permissions. Not available with an API key.",
+		tags:      []string{"users"},
+		activated: true,
+		body: closedObject(map[string]*schema{
+			"name":        str(1, 100),
+			"permissions": {Type: "array", Items: &schema{Type: "string"}, MinItems: intPtr(1), UniqueItems: true},
+			"allowed_ips": {Type: "array", Items: &schema{Type: "string"}, MaxItems: intPtr(20), UniqueItems: true},
+		}, "name", "permissions"),
+		status:   http.StatusCreated,
+		response: envelopeOf("api_key", ref("APIKey")),
+	},
+	"DELETE /v1/users/me/api-keys/:id": {
+		summary:   "Revoke an API key of the authenticated user. Not available with an API key.",
+		tags:      []string{"users"},
+		activated: true,
+		response:  messageSchema(),
+	},
+	"POST /v1/users/me/api-keys/:id/rotate": {
+		summary:   "Replace the secret of an API key, the previous one stops working immediately. Not available with an API key.",
+		tags:      []string{"users"},
+		activated: true,
+		response:  envelopeOf("api_key", ref("APIKey")),
+	},
+	"GET /v1/users/me/oauth-consents": {
+		summary:   "Show the OAuth clients the authenticated user granted access to their account",
+		tags:      []string{"users"},
+		activated: true,
+		response:  envelopeOf("consents", arrayOf(ref("OAuthConsent"))),
+	},
+	"DELETE /v1/users/me/oauth-consents/:id": {
+		summary:   "Revoke the access of an OAuth client, along with the tokens issued to it",
+		tags:      []string{"users"},
+		activated: true,
+		response:  messageSchema(),
+	},
+
+	"GET /v1/oauth/clients": {
+		summary:   "Show the OAuth clients registered by the authenticated user",
+		tags:      []string{"oauth"},
+		activated: true,
+		response:  envelopeOf("clients", arrayOf(ref("OAuthClient"))),
+	},
+	"POST /v1/oauth/clients": {
+		summary:   "Register an OAuth client. Clients are confidential unless confidential is false.",
+		tags:      []string{"oauth"},
+		activated: true,
+		body: closedObject(map[string]*schema{
+			"name":          str(1, 100),
+			"redirect_uris": {Type: "array", Items: &schema{Type: "string", Format: "uri"}, MinItems: intPtr(1), MaxItems: intPtr(10), UniqueItems: true},
+			"scopes":        {Type: "array", Items: &schema{Type: "string"}, MinItems: intPtr(1), UniqueItems: true},
+			"confidential":  boolean(),
+		}, "name", "redirect_uris", "scopes"),
+		status:   http.StatusCreated,
+		response: envelopeOf("client", ref("OAuthClient")),
+	},
+	"DELETE /v1/oauth/clients/:id": {
+		summary:   "Delete an OAuth client, revoking every token issued to it",
+		tags:      []string{"oauth"},
+		activated: true,
+		response:  messageSchema(),
+	},
+	"POST /v1/oauth/authorize": {
+		summary:   "Grant an OAuth client access to the authenticated user's account, returning the URI to redirect the user to with an authorization code",
+		tags:      []string{"oauth"},
+		activated: true,
+		body: closedObject(map[string]*schema{
+			"response_type":         enum("code"),
+			"client_id":             {Type: "string"},
+			"redirect_uri":          {Type: "string", Format: "uri"},
+			"scope":                 {Type: "string", Description: "A space separated list of permission codes."},
+			"state":                 str(0, 500),
+			"code_challenge":        str(43, 43),
+			"code_challenge_method": enum("S256"),
+		}, "response_type", "client_id", "redirect_uri", "scope", "code_challenge", "code_challenge_method"),
+		response: envelopeOf("redirect_uri", &schema{Type: "string", Format: "uri"}),
+	},
+	"POST /v1/oauth/token": {
+		summary:         "Exchange an authorization code, a refresh token or the client credentials for tokens. Errors use the format of RFC 6749.",
+		tags:            []string{"oauth"},
+		bodyContentType: "application/x-www-form-urlencoded",
+		body: object(map[string]*schema{
+			"grant_type":    enum("authorization_code", "refresh_token", "client_credentials"),
+			"code":          {Type: "string"},
+			"redirect_uri":  {Type: "string"},
+			"code_verifier": {Type: "string"},
+			"refresh_token": {Type: "string"},
+			"scope":         {Type: "string"},
+			"client_id":     {Type: "string", Description: "Only when the client doesn't use HTTP Basic authentication."},
+			"client_secret": {Type: "string", Description: "Only when the client doesn't use HTTP Basic authentication."},
+		}, "grant_type"),
+		response: object(map[string]*schema{
+			"access_token":  {Type: "string"},
+			"token_type":    enum("Bearer"),
+			"expires_in":    {Type: "integer"},
+			"refresh_token": {Type: "string", Description: "Not included for the client credentials grant."},
+			"scope":         {Type: "string"},
+		}, "access_token", "token_type", "expires_in", "scope"),
+		errors: []int{http.StatusUnauthorized},
+	},
+	"GET /.well-known/oauth-authorization-server": {
+		summary:  "Show the OAuth authorization server metadata of RFC 8414",
+		tags:     []string{"oauth"},
+		response: &schema{Type: "object"},
+	},
+
+	"GET /v1/admin/users": {
+		summary:    "Search the users",
+		tags:       []string{"admin"},
+		permission: "users:admin",
+		query: append([]apiParam{
+			{name: "q", description: "Only show the users whose name or email address contains this text.", schema: str(0, 500)},
+			{name: "activated", description: "Only show the users who activated their account, or who didn't.", schema: enum("true", "false")},
+			{name: "created_after", description: "Only show the users created at or after this time.", schema: &schema{Type: "string", Format: "date-time"}},
+			{name: "created_before", description: "Only show the users created before this time.", schema: &schema{Type: "string", Format: "date-time"}},
+		}, paginationParams("id", "name", "email", "created_at", "-id", "-name", "-email", "-created_at")...),
+		response: paginated("users", "User"),
+	},
+	"GET /v1/admin/users/:id": {
+		summary:    "Show a specific user with their roles and effective permissions",
+		tags:       []string{"admin"},
+		permission: "users:admin",
+		response: object(map[string]*schema{
+			"user":        ref("User"),
+			"roles":       arrayOf(&schema{Type: "string"}),
+			"permissions": arrayOf(&schema{Type: "string", Description: "The permissions granted directly or through a role."}),
+		}, "user", "roles", "permissions"),
+	},
+	"PUT /v1/admin/users/:id/deactivated": {
+		summary:    "Deactivate a user, logging them out everywhere and stopping them from logging in. Administrators can't deactivate themselves.",
+		tags:       []string{"admin"},
+		permission: "users:admin",
+		response:   envelopeOf("user", ref("User")),
+		errors:     []int{http.StatusBadRequest, http.StatusConflict},
+	},
+	"DELETE /v1/admin/users/:id/deactivated": {
+		summary:    "Reactivate a deactivated user",
+		tags:       []string{"admin"},
+		permission: "users:admin",
+		response:   envelopeOf("user", ref("User")),
+		errors:     []int{http.StatusConflict},
+	},
+	"DELETE /v1/admin/users/:id/sessions": {
+		summary:    "Revoke every session of a user, logging them out everywhere",
+		tags:       []string{"admin"},
+		permission: "users:admin",
+		response:   messageSchema(),
+	},
+	"POST /v1/admin/users/:id/permissions": {
+		summary:    "Grant permissions to a user directly, returning their roles and effective permissions",
+		tags:       []string{"admin"},
+		permission: "users:admin",
+		body: closedObject(map[string]*schema{
+			"permissions": {Type: "array", Items: &schema{Type: "string"}, MinItems: intPtr(1), UniqueItems: true},
+		}, "permissions"),
+		response: userAccessSchema(),
+	},
+	"DELETE /v1/admin/users/:id/permissions/:code": {
+		summary:    "Revoke a permission granted directly to a user, returning their roles and effective permissions. Administrators can't revoke users:admin from themselves.",
+		tags:       []string{"admin"},
+		permission: "users:admin",
+		response:   userAccessSchema(),
+		errors:     []int{http.StatusBadRequest},
+	},
+	"POST /v1/admin/users/:id/roles": {
+		summary:    "Give roles to a user, returning their roles and effective permissions",
+		tags:       []string{"admin"},
+		permission: "users:admin",
+		body: closedObject(map[string]*schema{
+			"roles": {Type: "array", Items: &schema{Type: "string"}, MinItems: intPtr(1), UniqueItems: true},
+		}, "roles"),
+		response: userAccessSchema(),
+	},
+	"DELETE /v1/admin/users/:id/roles/:role": {
+		summary:    "Take a role away from a user, returning their roles and effective permissions. Administrators can't take away from themselves a role granting users:admin.",
+		tags:       []string{"admin"},
+		permission: "users:admin",
+		response:   userAccessSchema(),
+		errors:     []int{http.StatusBadRequest},
+	},
+	"DELETE /v1/admin/users/:id/lockout": {
+		summary:    "Unlock the account of a user locked out after failed logins",
+		tags:       []string{"admin"},
+		permission: "users:admin",
+		response:   messageSchema(),
+	},
+	"GET /v1/admin/roles": {
+		summary:    "Show the roles with their permissions",
+		tags:       []string{"admin"},
+		permission: "users:admin",
+		response:   envelopeOf("roles", arrayOf(ref("Role"))),
+	},
+	"POST /v1/admin/roles": {
+		summary:    "Create a role bundling permissions",
+		tags:       []string{"admin"},
+		permission: "users:admin",
+		body: closedObject(map[string]*schema{
+			"name":        {Type: "string", Pattern: data.RoleNameRX.String(), MinLength: intPtr(1), MaxLength: intPtr(100)},
+			"description": str(0, 2000),
+			"permissions": {Type: "array", Items: &schema{Type: "string"}, UniqueItems: true},
+		}, "name", "permissions"),
+		status:   http.StatusCreated,
+		response: envelopeOf("role", ref("Role")),
+	},
+	"GET /v1/admin/roles/:id": {
+		summary:    "Show a specific role",
+		tags:       []string{"admin"},
+		permission: "users:admin",
+		response:   envelopeOf("role", ref("Role")),
+	},
+	"PATCH /v1/admin/roles/:id": {
+		summary:    "Update a role, replacing its permissions when provided. The change applies to every user with the role, and the default role can't be renamed.",
+		tags:       []string{"admin"},
+		permission: "users:admin",
+		body: closedObject(map[string]*schema{
+			"name":        {Type: "string", Pattern: data.RoleNameRX.String(), MinLength: intPtr(1), MaxLength: intPtr(100)},
+			"description": str(0, 2000),
+			"permissions": {Type: "array", Items: &schema{Type: "string"}, UniqueItems: true},
+		}),
+		response: envelopeOf("role", ref("Role")),
+		errors:   []int{http.StatusConflict},
+	},
+	"DELETE /v1/admin/roles/:id": {
+		summary:    "Delete a role, taking it away from the users who had it. The default role can't be deleted.",
+		tags:       []string{"admin"},
+		permission: "users:admin",
+		response:   messageSchema(),
+		errors:     []int{http.StatusBadRequest},
+	},
+
+	"POST /v1/tokens/authentication": {
+		summary: "Generate a new authentication token. Repeated failures delay, then lock out, further attempts for the account and the client IP address.",
+		tags:    []string{"tokens"},
+		body: closedObject(map[string]*schema{
+			"email":    emailSchema(),
+			"password": passwordSchema(),
+		}, "email", "password"),
+		status: http.StatusCreated,
+		response: &schema{
+			Description: "The tokens, or a two-factor token to exchange at POST /v1/tokens/two-factor when the user has enabled two-factor authentication.",
+			OneOf:       []*schema{tokenPair(), envelopeOf("two_factor_token", ref("Token"))},
+		},
+		errors: []int{http.StatusUnauthorized, http.StatusForbidden},
+	},
+	"POST /v1/tokens/two-factor": {
+		summary: "Exchange a two-factor token and a code from an authenticator app, or a recovery code, for new authentication and refresh tokens. Invalid codes count as failed logins, and the two-factor token is deleted after 5 of them.",
+		tags:    []string{"tokens"},
+		body: closedObject(map[string]*schema{
+			"two_factor_token": tokenSchema(),
+			"code":             twoFactorCodeSchema(),
+		}, "two_factor_token", "code"),
+		status:   http.StatusCreated,
+		response: tokenPair(),
+	},
+	"POST /v1/tokens/refresh": {
+		summary:  "Exchange a refresh token for new authentication and refresh tokens. Reusing a refresh token revokes every session of its user.",
+		tags:     []string{"tokens"},
+		body:     closedObject(map[string]*schema{"refresh_token": tokenSchema()}, "refresh_token"),
+		status:   http.StatusCreated,
+		response: tokenPair(),
+	},
+	"POST /v1/tokens/oidc/authorization": {
+		summary:  "Start logging in with the external OpenID Connect provider, returning the URL to send the user to",
+		tags:     []string{"tokens"},
+		status:   http.StatusCreated,
+		response: envelopeOf("authorization_url", &schema{Type: "string", Format: "uri"}),
+		errors:   []int{http.StatusServiceUnavailable},
+	},
+	"POST /v1/tokens/oidc": {
+		summary: "Exchange the code and state the OpenID Connect provider redirected the user with for new authentication and refresh tokens. Users are linked by verified email address, or created. Unactivated users are activated with a random password, since whoever registered them may not own the address. Delays and lockouts after failed logins apply as for POST /v1/tokens/authentication.",
+		tags:    []string{"tokens"},
+		body: closedObject(map[string]*schema{
+			"code":  str(1, 2000),
+			"state": str(1, 0),
+		}, "code", "state"),
+		status: http.StatusCreated,
+		response: &schema{
+			Description: "The tokens, or a two-factor token to exchange at POST /v1/tokens/two-factor when the user has enabled two-factor authentication.",
+			OneOf:       []*schema{tokenPair(), envelopeOf("two_factor_token", ref("Token"))},
+		},
+		errors: []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusServiceUnavailable},
+	},
+	"DELETE /v1/tokens/authentication": {
+		summary:       "Revoke the authentication token used by the request",
+		tags:          []string{"tokens"},
+		authenticated: true,
+		response:      messageSchema(),
+		errors:        []int{http.StatusBadRequest},
+	},
+	"POST /v1/tokens/activation": {
+		summary:  "Email a new activation token to the unactivated user with the given email address",
+		tags:     []string{"tokens"},
+		body:     closedObject(map[string]*schema{"email": emailSchema()}, "email"),
+		status:   http.StatusAccepted,
+		response: messageSchema(),
+	},
+	"POST /v1/tokens/password-reset": {
+		summary:  "Email a password reset token to the user with the given email address",
+		tags:     []string{"tokens"},
+		body:     closedObject(map[string]*schema{"email": emailSchema()}, "email"),
+		status:   http.StatusAccepted,
+		response: messageSchema(),
+	},
+}
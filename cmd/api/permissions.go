@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/hayohtee/greenlight/internal/data"
+	"github.com/lib/pq"
+	"strconv"
+	"time"
+)
+
+// listenForPermissionChanges launches a background goroutine which invalidates the
+// cached permissions of the users whose permissions changed, whichever instance of
+// the application, or operator, changed them.
+func (app *application) listenForPermissionChanges() error {
+	cache := app.models.Permissions.Cache
+	if cache == nil {
+		return nil
+	}
+
+	listener := pq.NewListener(app.config.db.dsn, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"task": "listen for permission changes"})
+		}
+	})
+
+	err := listener.Listen(data.PermissionChangesChannel)
+	if err != nil {
+		return err
+	}
+
+	app.background(func() {
+		defer listener.Close()
+
+		ping := time.NewTicker(90 * time.Second)
+		defer ping.Stop()
+
+		for {
+			select {
+			case n := <-listener.NotificationChannel():
+				// A nil notification is sent after the connection has been
+				// re-established, in which case the changes made in the meantime
+				// were missed. The whole cache is purged then, as it is for the
+				// changes to the permissions of a role.
+				if n == nil || n.Extra == "" {
+					cache.Purge()
+					continue
+				}
+
+				userID, err := strconv.ParseInt(n.Extra, 10, 64)
+				if err != nil {
+					app.logger.PrintError(err, map[string]string{"task": "listen for permission changes"})
+					cache.Purge()
+					continue
+				}
+				cache.Invalidate(userID)
+			case <-ping.C:
+				go listener.Ping()
+			case <-app.shutdown:
+				return
+			}
+		}
+	})
+
+	return nil
+}
@@ -7,25 +7,101 @@ import (
 )
 
 func (app *application) routes() http.Handler {
-	router := httprouter.New()
+	router := &documentedRouter{
+		Router:   httprouter.New(),
+		validate: app.config.openapi.validate && app.config.env == "development",
+		app:      app,
+	}
 
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/openapi.json", app.openAPIHandler(router))
 
 	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("moves:write", app.createMovieHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("moves:read", app.showMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler))
+	router.document(http.MethodGet, "/v1/movies/events")
 	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
 
+	router.HandlerFunc(http.MethodGet, "/v1/stats/movies", app.requirePermission("movies:read", app.showMovieStatsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/stats/movies/refresh", app.requirePermission("stats:refresh", app.refreshMovieStatsHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/lists", app.requireActivatedUser(app.listListsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/lists", app.requireActivatedUser(app.createListHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:id", app.showListHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/lists/:id", app.requireActivatedUser(app.updateListHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id", app.requireActivatedUser(app.deleteListHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/lists/:id/items", app.requireActivatedUser(app.addListItemHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/lists/:id/items/:movie_id", app.requireActivatedUser(app.updateListItemHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id/items/:movie_id", app.requireActivatedUser(app.deleteListItemHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/shared/lists/:token", app.showSharedListHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks", app.requirePermission("webhooks:write", app.listWebhooksHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/webhooks", app.requirePermission("webhooks:write", app.createWebhookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks/:id", app.requirePermission("webhooks:write", app.showWebhookHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/webhooks/:id", app.requirePermission("webhooks:write", app.updateWebhookHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/webhooks/:id", app.requirePermission("webhooks:write", app.deleteWebhookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks/:id/deliveries", app.requirePermission("webhooks:write", app.listWebhookDeliveriesHandler))
+
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/email", app.confirmUserEmailHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me", app.requireAuthenticatedUser(app.showCurrentUserHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", app.requireActivatedUser(app.rejectDelegatedAccess(app.updateCurrentUserHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", app.requireAuthenticatedUser(app.rejectDelegatedAccess(app.deleteCurrentUserHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/deletion", app.requireAuthenticatedUser(app.rejectDelegatedAccess(app.cancelUserDeletionHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/export", app.requireAuthenticatedUser(app.rejectDelegatedAccess(app.exportCurrentUserHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me/email", app.requireActivatedUser(app.rejectDelegatedAccess(app.updateUserEmailHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/sessions", app.requireAuthenticatedUser(app.listSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions", app.requireAuthenticatedUser(app.deleteAllSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions/:id", app.requireAuthenticatedUser(app.deleteSessionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/2fa", app.requireActivatedUser(app.rejectDelegatedAccess(app.enableTwoFactorHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/2fa/confirmed", app.requireActivatedUser(app.rejectDelegatedAccess(app.confirmTwoFactorHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/2fa", app.requireActivatedUser(app.rejectDelegatedAccess(app.disableTwoFactorHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/api-keys", app.requireActivatedUser(app.rejectDelegatedAccess(app.listAPIKeysHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/api-keys", app.requireActivatedUser(app.rejectDelegatedAccess(app.createAPIKeyHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/api-keys/:id", app.requireActivatedUser(app.rejectDelegatedAccess(app.deleteAPIKeyHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/api-keys/:id/rotate", app.requireActivatedUser(app.rejectDelegatedAccess(app.rotateAPIKeyHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/oauth-consents", app.requireActivatedUser(app.rejectDelegatedAccess(app.listOAuthConsentsHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/oauth-consents/:id", app.requireActivatedUser(app.rejectDelegatedAccess(app.deleteOAuthConsentHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/oauth/clients", app.requireActivatedUser(app.rejectDelegatedAccess(app.listOAuthClientsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/oauth/clients", app.requireActivatedUser(app.rejectDelegatedAccess(app.createOAuthClientHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/oauth/clients/:id", app.requireActivatedUser(app.rejectDelegatedAccess(app.deleteOAuthClientHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/oauth/authorize", app.requireActivatedUser(app.rejectDelegatedAccess(app.authorizeOAuthClientHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/oauth/token", app.oauthTokenHandler)
+	router.HandlerFunc(http.MethodGet, "/.well-known/oauth-authorization-server", app.oauthMetadataHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users", app.requirePermission("users:admin", app.listUsersHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id", app.requirePermission("users:admin", app.showUserHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/deactivated", app.requirePermission("users:admin", app.deactivateUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/deactivated", app.requirePermission("users:admin", app.reactivateUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/sessions", app.requirePermission("users:admin", app.logoutUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.grantUserPermissionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/permissions/:code", app.requirePermission("users:admin", app.revokeUserPermissionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/roles", app.requirePermission("users:admin", app.grantUserRolesHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/roles/:role", app.requirePermission("users:admin", app.revokeUserRoleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/lockout", app.requirePermission("users:admin", app.unlockUserHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/roles", app.requirePermission("users:admin", app.listRolesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/roles", app.requirePermission("users:admin", app.createRoleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/roles/:id", app.requirePermission("users:admin", app.showRoleHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/admin/roles/:id", app.requirePermission("users:admin", app.updateRoleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/roles/:id", app.requirePermission("users:admin", app.deleteRoleHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication", app.requireAuthenticatedUser(app.deleteAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/two-factor", app.createTwoFactorAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.refreshAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/oidc/authorization", app.createOIDCAuthorizationURLHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/oidc", app.createOIDCAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
 
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
-	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router)))))
+	return app.metrics(app.compress(app.recoverPanic(app.enableCORS(app.negotiateContent(app.rateLimit(app.authenticate(router)))))))
 }
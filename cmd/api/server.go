@@ -20,6 +20,10 @@ func (app *application) serve() error {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	// Close the open event streams on shutdown, as they would otherwise never
+	// become idle.
+	srv.RegisterOnShutdown(app.events.closeAll)
+
 	shutdownError := make(chan error)
 
 	go func() {
@@ -53,6 +57,9 @@ func (app *application) serve() error {
 			"addr": srv.Addr,
 		})
 
+		// Stop the periodic background tasks, then wait for them to complete their
+		// current run along with the other background tasks.
+		close(app.shutdown)
 		app.wg.Wait()
 		shutdownError <- nil
 	}()
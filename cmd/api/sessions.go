@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"github.com/hayohtee/greenlight/internal/data"
+	"net/http"
+)
+
+// deleteAuthenticationTokenHandler revokes the authentication token used by the
+// request, logging the client out.
+func (app *application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	session := app.contextGetSession(r)
+	if session == nil {
+		app.badRequestResponse(w, r, errors.New("the request must be authenticated with an authentication token"))
+		return
+	}
+
+	err := app.revokeSession(user.ID, session.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			// The session is gone already, but a signed token issued for it is still
+			// valid until it expires.
+			err = app.revokeSignedToken(session.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "you have been logged out"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	sessions, err := app.models.Tokens.GetSessionsForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Flag the session used by this request.
+	if current := app.contextGetSession(r); current != nil {
+		for _, session := range sessions {
+			session.Current = session.ID == current.ID
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.revokeSession(user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "session successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAllSessionsHandler revokes every authentication and refresh token of the user, including
+// the one used by the request, logging them out everywhere.
+func (app *application) deleteAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.revokeAllSessions(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "you have been logged out everywhere"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"errors"
+	"github.com/hayohtee/greenlight/internal/data"
+	"github.com/hayohtee/greenlight/internal/jwt"
+	"github.com/lib/pq"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Define constants for the token modes.
+const (
+	// tokensModeDatabase issues random authentication tokens looked up in the database.
+	tokensModeDatabase = "database"
+	// tokensModeSigned issues signed authentication tokens verified without the database.
+	tokensModeSigned = "signed"
+)
+
+// revocationList holds the IDs of the revoked signed tokens which haven't expired yet,
+// along with the users whose signed tokens were all revoked. It mirrors the
+// revoked_tokens and revoked_users_tokens tables, so that tokens can be checked on
+// every request without a query.
+type revocationList struct {
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+	users   map[int64]data.UserRevocation
+}
+
+func newRevocationList() *revocationList {
+	return &revocationList{
+		revoked: make(map[string]time.Time),
+		users:   make(map[int64]data.UserRevocation),
+	}
+}
+
+func (l *revocationList) add(jti string, expiry time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.revoked[jti] = expiry
+}
+
+func (l *revocationList) addUser(userID int64, revocation data.UserRevocation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.users[userID] = latestRevocation(l.users[userID], revocation)
+}
+
+func (l *revocationList) contains(jti string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	_, ok := l.revoked[jti]
+	return ok
+}
+
+// containsUser reports whether the signed tokens of the user issued at the given time
+// are revoked. Token issue times are only precise to the second, so a token issued
+// within the same second as the revocation, but after it, is rejected as well.
+func (l *revocationList) containsUser(userID int64, issuedAt time.Time) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	revocation, ok := l.users[userID]
+	return ok && !issuedAt.After(revocation.Before)
+}
+
+// merge adds the revocations read from the database to the list, dropping the expired
+// ones. Revocations are never undone, so the ones only known locally are kept, as they
+// may have been added while the database was being read.
+func (l *revocationList) merge(revoked map[string]time.Time, users map[int64]data.UserRevocation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for jti, expiry := range l.revoked {
+		if expiry.After(now) {
+			revoked[jti] = expiry
+		}
+	}
+	l.revoked = revoked
+
+	for userID, revocation := range l.users {
+		if revocation.Expiry.After(now) {
+			users[userID] = latestRevocation(users[userID], revocation)
+		}
+	}
+	l.users = users
+}
+
+// latestRevocation combines two revocations of the tokens of the same user, keeping
+// the latest revocation time and expiry of both.
+func latestRevocation(a, b data.UserRevocation) data.UserRevocation {
+	if b.Before.After(a.Before) {
+		a.Before = b.Before
+	}
+	if b.Expiry.After(a.Expiry) {
+		a.Expiry = b.Expiry
+	}
+	return a
+}
+
+// issueAuthenticationToken returns the authentication token to send to the client for
+// the token stored in the database. In the signed mode, it is replaced by a signed
+// token with the same expiry, whose ID is the ID of the stored token. The stored token
+// is then only kept to track the session.
+func (app *application) issueAuthenticationToken(user *data.User, token *data.Token) (*data.Token, error) {
+	if app.config.tokens.mode != tokensModeSigned {
+		return token, nil
+	}
+
+	plainText, err := app.signingKeys.Sign(jwt.Claims{
+		Subject:   strconv.FormatInt(user.ID, 10),
+		ExpiresAt: token.Expiry.Unix(),
+		IssuedAt:  time.Now().Unix(),
+		ID:        strconv.FormatInt(token.ID, 10),
+		Scope:     data.ScopeAuthentication,
+		Activated: user.Activated,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Token{PlainText: plainText, Expiry: token.Expiry}, nil
+}
+
+// verifySignedToken checks the signed authentication token, returning the user and
+// session it was issued for. The user only has its ID and activation status set, as
+// they are read from the token claims. Deactivated users and users whose deletion is
+// scheduled have had their tokens revoked, which every instance is notified of.
+func (app *application) verifySignedToken(token string) (*data.User, *data.Session, error) {
+	if app.signingKeys == nil {
+		return nil, nil, jwt.ErrInvalidToken
+	}
+
+	claims, err := app.signingKeys.Verify(token, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if claims.Scope != data.ScopeAuthentication || app.revocations.contains(claims.ID) {
+		return nil, nil, jwt.ErrInvalidToken
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, nil, jwt.ErrInvalidToken
+	}
+
+	if app.revocations.containsUser(userID, time.Unix(claims.IssuedAt, 0)) {
+		return nil, nil, jwt.ErrInvalidToken
+	}
+
+	sessionID, err := strconv.ParseInt(claims.ID, 10, 64)
+	if err != nil {
+		return nil, nil, jwt.ErrInvalidToken
+	}
+
+	user := &data.User{ID: userID, Activated: claims.Activated}
+	session := &data.Session{ID: sessionID, Expiry: time.Unix(claims.ExpiresAt, 0), Current: true}
+
+	return user, session, nil
+}
+
+// revokeSession deletes the session with the given ID, along with the tokens issued
+// from the same login. When signed tokens are in use, the signed token of the session
+// is revoked as well, since it stays valid until it expires otherwise.
+func (app *application) revokeSession(userID, sessionID int64) error {
+	err := app.models.Tokens.DeleteSession(userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	return app.revokeSignedToken(sessionID)
+}
+
+// revokeAllSessions deletes every authentication and refresh token of the user, and
+// revokes every signed token issued to them until now. The signed tokens are revoked
+// by user rather than by session, so that none is missed if a session is created
+// while they are being revoked.
+func (app *application) revokeAllSessions(userID int64) error {
+	if app.signingKeys != nil {
+		now := time.Now()
+		revocation := data.UserRevocation{
+			Before: now,
+			Expiry: now.Add(app.config.tokens.authenticationTTL),
+		}
+
+		err := app.models.Tokens.RevokeUser(userID, revocation)
+		if err != nil {
+			return err
+		}
+
+		app.revocations.addUser(userID, revocation)
+	}
+
+	for _, scope := range []string{data.ScopeAuthentication, data.ScopeRefresh} {
+		err := app.models.Tokens.DeleteAllForUser(scope, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// revokeOtherSessions revokes every session of the user but the current one, which is
+// nil for requests which weren't authenticated with a session.
+func (app *application) revokeOtherSessions(userID int64, current *data.Session) error {
+	sessions, err := app.models.Tokens.GetSessionsForUser(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if current != nil && session.ID == current.ID {
+			continue
+		}
+
+		err := app.revokeSession(userID, session.ID)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// revokeSignedToken adds the signed token issued for the session to the revocation
+// list. Signed tokens never outlive the authentication token lifetime, which bounds
+// how long the revocation is kept.
+func (app *application) revokeSignedToken(sessionID int64) error {
+	if app.signingKeys == nil {
+		return nil
+	}
+
+	jti := strconv.FormatInt(sessionID, 10)
+	expiry := time.Now().Add(app.config.tokens.authenticationTTL)
+
+	err := app.models.Tokens.Revoke(jti, expiry)
+	if err != nil {
+		return err
+	}
+
+	app.revocations.add(jti, expiry)
+	return nil
+}
+
+// syncRevocations reloads the revocation list from the database, picking up the
+// tokens revoked by the other instances of the application.
+func (app *application) syncRevocations() error {
+	revoked, err := app.models.Tokens.GetRevoked()
+	if err != nil {
+		return err
+	}
+
+	users, err := app.models.Tokens.GetRevokedUsers()
+	if err != nil {
+		return err
+	}
+
+	app.revocations.merge(revoked, users)
+	return nil
+}
+
+// syncRevocationsPeriodically loads the revocation list, then reloads it as soon as
+// the database notifies of new revocations, and once every sync interval in case a
+// notification was missed.
+func (app *application) syncRevocationsPeriodically() error {
+	if app.signingKeys == nil {
+		return nil
+	}
+
+	if app.config.tokens.revocationSyncInterval <= 0 {
+		return errors.New("the revocation sync interval must be positive when signed tokens are enabled")
+	}
+
+	listener := pq.NewListener(app.config.db.dsn, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"task": "listen for revoked tokens"})
+		}
+	})
+
+	// Listen before loading the revocation list, so that no revocation is missed in
+	// between.
+	err := listener.Listen(data.TokenRevocationsChannel)
+	if err != nil {
+		return err
+	}
+
+	err = app.syncRevocations()
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	reload := func() {
+		err := app.syncRevocations()
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"task": "sync revoked tokens"})
+		}
+	}
+
+	app.background(func() {
+		defer listener.Close()
+
+		ping := time.NewTicker(90 * time.Second)
+		defer ping.Stop()
+
+		for {
+			select {
+			// A nil notification is sent after the connection has been re-established,
+			// in which case the list is reloaded too, as notifications may have been
+			// missed in the meantime.
+			case <-listener.NotificationChannel():
+				reload()
+			case <-ping.C:
+				go listener.Ping()
+			case <-app.shutdown:
+				return
+			}
+		}
+	})
+
+	app.periodically(app.config.tokens.revocationSyncInterval, reload)
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/hayohtee/greenlight/internal/validator"
+	"net/http"
+)
+
+func (app *application) showMovieStatsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	weeks := app.readInt(r.URL.Query(), "weeks", 12, v)
+	v.Check(weeks > 0, "weeks", "must be greater than zero")
+	v.Check(weeks <= 520, "weeks", "must be a maximum of 520")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	stats, err := app.models.Stats.GetMovieStats(weeks)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) refreshMovieStatsHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Stats.Refresh()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	stats, err := app.models.Stats.GetMovieStats(12)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// refreshStatsPeriodically launches a background goroutine which recomputes
+// the catalog statistics once every refresh interval.
+func (app *application) refreshStatsPeriodically() {
+	if app.config.stats.refreshInterval <= 0 {
+		return
+	}
+
+	app.periodically(app.config.stats.refreshInterval, func() {
+		err := app.models.Stats.Refresh()
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"task": "refresh movie stats"})
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hayohtee/greenlight/internal/data"
+	"github.com/hayohtee/greenlight/internal/jsonlog"
+	"github.com/hayohtee/greenlight/internal/passwords"
+)
+
+// newTestApplication returns an application backed by the database named by the
+// GREENLIGHT_TEST_DB_DSN environment variable, which must have every migration
+// applied. The test is skipped otherwise.
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	dsn := os.Getenv("GREENLIGHT_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("GREENLIGHT_TEST_DB_DSN isn't set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	var cfg config
+	cfg.db.dsn = dsn
+	cfg.tokens.mode = tokensModeDatabase
+	cfg.tokens.authenticationTTL = 15 * time.Minute
+	cfg.tokens.refreshTTL = time.Hour
+	cfg.login.lockoutThreshold = 10
+	cfg.login.ipLockoutThreshold = 100
+	cfg.login.lockoutDuration = 15 * time.Minute
+	cfg.login.failureWindow = time.Hour
+
+	app := &application{
+		config:         cfg,
+		logger:         jsonlog.New(io.Discard, jsonlog.LevelOff),
+		models:         data.NewModels(db),
+		revocations:    newRevocationList(),
+		passwordPolicy: &passwords.Policy{},
+		shutdown:       make(chan struct{}),
+	}
+	t.Cleanup(app.wg.Wait)
+
+	return app
+}
+
+// uniqueEmail returns an email address unused by the previous test runs, and deletes
+// the user with it and its failed logins once the test is done.
+func uniqueEmail(t *testing.T, app *application) string {
+	t.Helper()
+
+	email := fmt.Sprintf("test-%d@example.com", time.Now().UnixNano())
+
+	t.Cleanup(func() {
+		_, err := app.models.Users.DB.Exec("DELETE FROM users WHERE email = $1", email)
+		if err != nil {
+			t.Error(err)
+		}
+		deleteLoginFailures(t, app, data.AccountKey(email))
+	})
+
+	return email
+}
+
+// uniqueIP returns a client IP address from the benchmarking range unlikely to be used
+// by the previous test runs, and deletes its failed logins once the test is done.
+func uniqueIP(t *testing.T, app *application) string {
+	t.Helper()
+
+	n := time.Now().UnixNano()
+	ip := fmt.Sprintf("198.18.%d.%d", n%250, n/250%250)
+
+	t.Cleanup(func() { deleteLoginFailures(t, app, ip) })
+
+	return ip
+}
+
+func deleteLoginFailures(t *testing.T, app *application, key string) {
+	t.Helper()
+
+	_, err := app.models.LoginFailures.DB.Exec("DELETE FROM login_failures WHERE key = $1", key)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// insertTestUser inserts an activated user with the given password, deleted once the
+// test is done.
+func insertTestUser(t *testing.T, app *application, password string) *data.User {
+	t.Helper()
+
+	user := &data.User{Name: "Test", Email: uniqueEmail(t, app), Activated: true}
+
+	err := user.Password.Set(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.models.Users.Insert(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
@@ -5,9 +5,19 @@ import (
 	"github.com/hayohtee/greenlight/internal/data"
 	"github.com/hayohtee/greenlight/internal/validator"
 	"net/http"
+	"strconv"
 	"time"
 )
 
+// twoFactorTokenTTL is how long a user has to provide a two-factor code after their
+// password.
+const twoFactorTokenTTL = 5 * time.Minute
+
+// twoFactorMaxAttempts is how many invalid codes can be sent with a two-factor challenge
+// token, or with a session to disable two-factor authentication, before it is deleted,
+// and the user has to log in again.
+const twoFactorMaxAttempts = 5
+
 func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Email    string `json:"email"`
@@ -30,13 +40,38 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
+	// Refuse the attempt while the account or the client is delayed or locked out
+	// after failed logins, before checking the password.
+	ip := app.clientIP(r)
+
+	retryAfter, failure, err := app.loginRetryAfter(input.Email, ip)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if retryAfter > 0 {
+		app.loginThrottledResponse(w, r, retryAfter)
+		return
+	}
+
 	// Look up the user record based on the email address. If no matching user
 	// was found then we call the app.invalidCredentialsResponse() helper to send
-	// 401 Unauthorized response to the client.
+	// 401 Unauthorized response to the client, after spending as long as checking
+	// a password and counting the failure, so that unknown emails can't be told
+	// apart from registered ones.
 	user, err := app.models.Users.GetByEmail(input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
+			data.SimulatePasswordCheck(input.Password)
+
+			err = app.recordLoginFailure(input.Email, ip, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
 			app.invalidCredentialsResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
@@ -51,21 +86,418 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
-	// If the password do not match, call app.invalidCredentialsResponse() helper
-	// again and return.
+	// If the password do not match, count the failure and call
+	// app.invalidCredentialsResponse() helper again and return.
 	if !match {
+		err = app.recordLoginFailure(input.Email, ip, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
 		app.invalidCredentialsResponse(w, r)
 		return
 	}
 
-	// Generate new token with 24-hour expiry time and scope 'authentication'.
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	app.completeLogin(w, r, user, failure)
+}
+
+// completeLogin logs in the user once they proved who they are, with their password or
+// with the external OpenID Connect provider. Users with two-factor authentication
+// enabled get a short-lived challenge token instead, to exchange along with a code for
+// the authentication token. The failure is the counter of the failed logins of the
+// account, if there is one.
+func (app *application) completeLogin(w http.ResponseWriter, r *http.Request, user *data.User, failure *data.LoginFailure) {
+	// Deactivated users are only told so once they proved who they are.
+	if user.Deactivated {
+		app.deactivatedAccountResponse(w, r)
+		return
+	}
+
+	twoFactor, err := app.models.TwoFactor.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The failed logins of the account are only forgotten once the second factor is
+	// right too, so that they keep slowing down attempts to guess the code.
+	if twoFactor != nil && twoFactor.Enabled() {
+		token, err := app.models.Tokens.New(user.ID, twoFactorTokenTTL, data.ScopeTwoFactor)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusCreated, envelope{"two_factor_token": token}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.resetLoginFailures(failure)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.createSession(w, r, user)
+}
+
+// createTwoFactorAuthenticationTokenHandler exchanges the challenge token issued after
+// a valid password or OpenID Connect login, along with a code from the authenticator
+// app or a recovery code, for an authentication token.
+func (app *application) createTwoFactorAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TwoFactorToken string `json:"two_factor_token"`
+		Code           string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.TwoFactorToken != "", "two_factor_token", "must be provided")
+	v.Check(len(input.TwoFactorToken) == 26, "two_factor_token", "must be 26 bytes long")
+	data.ValidateTwoFactorCode(v, input.Code)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopeTwoFactor, input.TwoFactorToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("two_factor_token", "invalid or expired two-factor token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Codes are subject to the same delays and lockouts as passwords.
+	ip := app.clientIP(r)
+
+	retryAfter, failure, err := app.loginRetryAfter(user.Email, ip)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if retryAfter > 0 {
+		app.loginThrottledResponse(w, r, retryAfter)
+		return
+	}
+
+	ok, err := app.verifyTwoFactorCode(user.ID, input.Code)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Two-factor authentication may have been disabled since the token was issued, in
+	// which case the user must log in again.
+	if !ok {
+		err = app.recordLoginFailure(user.Email, ip, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// Delete the challenge token after too many invalid codes, so that each
+		// password check only allows a few guesses.
+		attempts, err := app.models.Tokens.RecordFailedAttempt(data.ScopeTwoFactor, input.TwoFactorToken)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if attempts >= twoFactorMaxAttempts {
+			err = app.models.Tokens.DeleteAllForUser(data.ScopeTwoFactor, user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			v.AddError("two_factor_token", "too many invalid codes, log in again")
+		}
+
+		v.AddError("code", "invalid code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeTwoFactor, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.resetLoginFailures(failure)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.createSession(w, r, user)
+}
+
+// createSession generates a short-lived authentication token along with a long-lived
+// refresh token to get new ones, recording the client they were issued to so that the
+// user can recognize the session, and sends them to the client.
+func (app *application) createSession(w http.ResponseWriter, r *http.Request, user *data.User) {
+	authenticationToken, refreshToken, err := app.models.Tokens.NewSession(
+		user.ID,
+		app.config.tokens.authenticationTTL,
+		app.config.tokens.refreshTTL,
+		app.clientIP(r),
+		r.UserAgent(),
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	authenticationToken, err = app.issueAuthenticationToken(user, authenticationToken)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"authentication_token": authenticationToken, "refresh_token": refreshToken}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The response is the same whether or not a matching account exists, so that
+	// this endpoint can't be used to find out which email addresses are registered.
+	env := envelope{"message": "an email will be sent to you containing password reset instructions"}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			err = app.writeJSON(w, http.StatusAccepted, env, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Generate the token in the background along with the email, so that the response
+	// doesn't take noticeably longer when the account exists.
+	app.background(func() {
+		// Generate new token with 45-minute expiry time and scope 'password-reset'.
+		token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+
+		templateData := map[string]any{
+			"passwordResetToken": token.PlainText,
+		}
+
+		err = app.mailer.Send(user.Email, "token_password_reset.tmpl", templateData)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// As for password resets, the response is the same whatever the state of the
+	// account, so that this endpoint can't be used to find out who is registered.
+	env := envelope{"message": "an email will be sent to you containing activation instructions"}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if user != nil && !user.Activated {
+		app.background(func() {
+			// Only send a new token once the cooldown has passed since the latest one
+			// was issued, so that the endpoint can't be used to flood the address.
+			expiry, err := app.models.Tokens.LatestExpiry(data.ScopeActivation, user.ID)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+				return
+			}
+
+			if time.Until(expiry) > activationTokenTTL-app.config.activation.resendCooldown {
+				return
+			}
+
+			// Delete the previous activation tokens, so that only the latest one is valid.
+			err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+				return
+			}
+
+			token, err := app.models.Tokens.New(user.ID, activationTokenTTL, data.ScopeActivation)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+				return
+			}
+
+			templateData := map[string]any{
+				"activationToken": token.PlainText,
+			}
+
+			err = app.mailer.Send(user.Email, "token_activation.tmpl", templateData)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// refreshAuthenticationTokenHandler exchanges a refresh token for a new authentication
+// token and refresh token pair. Each refresh token can only be used once.
+func (app *application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	v := validator.New()
+	v.Check(input.RefreshToken != "", "refresh_token", "must be provided")
+	v.Check(len(input.RefreshToken) == 26, "refresh_token", "must be 26 bytes long")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	rotation, err := app.models.Tokens.Rotate(
+		input.RefreshToken,
+		0,
+		app.config.tokens.authenticationTTL,
+		app.config.tokens.refreshTTL,
+		app.clientIP(r),
+		r.UserAgent(),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("refresh_token", "invalid or expired refresh token")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrTokenReused):
+			// The token family has been revoked, but the signed tokens issued from it stay
+			// valid until they expire, and the refresh token may have been stolen along
+			// with other tokens of the user, so every session of the user is revoked and
+			// they must log in again.
+			err = app.revokeAllSessions(rotation.UserID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			app.logger.PrintInfo("refresh token reused, sessions revoked", map[string]string{
+				"ip":      app.clientIP(r),
+				"user_id": strconv.FormatInt(rotation.UserID, 10),
+			})
+			v.AddError("refresh_token", "invalid or expired refresh token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The signed tokens issued for the authentication tokens replaced by the rotation
+	// stay valid until they expire otherwise.
+	for _, id := range rotation.RevokedIDs {
+		err = app.revokeSignedToken(id)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	authenticationToken, refreshToken := rotation.AuthenticationToken, rotation.RefreshToken
+
+	// Signed tokens embed the user details, so the user must be read from the database.
+	if app.config.tokens.mode == tokensModeSigned {
+		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, authenticationToken.PlainText)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		authenticationToken, err = app.issueAuthenticationToken(user, authenticationToken)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	env := envelope{"authentication_token": authenticationToken, "refresh_token": refreshToken}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
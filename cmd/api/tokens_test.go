@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hayohtee/greenlight/internal/data"
+	"github.com/hayohtee/greenlight/internal/jwt"
+)
+
+// login posts the credentials to the authentication token endpoint from the address.
+func login(t *testing.T, app *application, email, password, remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	js, err := json.Marshal(map[string]string{"email": email, "password": password})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/tokens/authentication", bytes.NewReader(js))
+	r.RemoteAddr = remoteAddr
+	for key, value := range headers {
+		r.Header.Set(key, value)
+	}
+
+	rr := httptest.NewRecorder()
+	app.createAuthenticationTokenHandler(rr, r)
+	return rr
+}
+
+func TestLoginIPLockoutSpoofedForwardedFor(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.login.ipLockoutThreshold = 3
+
+	ip := uniqueIP(t, app)
+
+	// Each attempt is for another account, and claims to come from another address.
+	for i := range 3 {
+		rr := login(t, app, uniqueEmail(t, app), "pa55word1234", ip+":4321", map[string]string{
+			"X-Forwarded-For": fmt.Sprintf("203.0.113.%d", i+1),
+		})
+		if rr.Code != http.StatusUnauthorized {
+			t.Fatalf("got status %d for attempt %d; want %d: %s", rr.Code, i+1, http.StatusUnauthorized, rr.Body)
+		}
+	}
+
+	rr := login(t, app, uniqueEmail(t, app), "pa55word1234", ip+":4321", map[string]string{
+		"X-Forwarded-For": "203.0.113.100",
+	})
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d; want %d: %s", rr.Code, http.StatusTooManyRequests, rr.Body)
+	}
+}
+
+// refresh posts the refresh token to the refresh endpoint, returning the tokens of
+// the response if it succeeded.
+func refresh(t *testing.T, app *application, refreshToken string) (*httptest.ResponseRecorder, string, string) {
+	t.Helper()
+
+	js, err := json.Marshal(map[string]string{"refresh_token": refreshToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/tokens/refresh", bytes.NewReader(js))
+	rr := httptest.NewRecorder()
+	app.refreshAuthenticationTokenHandler(rr, r)
+
+	if rr.Code != http.StatusCreated {
+		return rr, "", ""
+	}
+
+	var output struct {
+		AuthenticationToken data.Token `json:"authentication_token"`
+		RefreshToken        data.Token `json:"refresh_token"`
+	}
+	err = json.Unmarshal(rr.Body.Bytes(), &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rr, output.AuthenticationToken.PlainText, output.RefreshToken.PlainText
+}
+
+func TestRefreshRevokesSignedTokens(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.tokens.mode = tokensModeSigned
+
+	keys, err := jwt.ParseKeyRing("test:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.signingKeys = keys
+
+	user := insertTestUser(t, app, "pa55word1234")
+
+	authenticationToken, refreshToken, err := app.models.Tokens.NewSession(user.ID, app.config.tokens.authenticationTTL, app.config.tokens.refreshTTL, "198.18.0.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := app.issueAuthenticationToken(user, authenticationToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr, rotated, _ := refresh(t, app, refreshToken.PlainText)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got status %d; want %d: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+
+	// The signed token of the rotated authentication token is revoked.
+	_, _, err = app.verifySignedToken(signed.PlainText)
+	if !errors.Is(err, jwt.ErrInvalidToken) {
+		t.Errorf("got error %v for the rotated token; want %v", err, jwt.ErrInvalidToken)
+	}
+
+	_, _, err = app.verifySignedToken(rotated)
+	if err != nil {
+		t.Fatalf("got error %v for the new token", err)
+	}
+
+	// Reusing the refresh token revokes the signed token issued by the rotation.
+	rr, _, _ = refresh(t, app, refreshToken.PlainText)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d; want %d: %s", rr.Code, http.StatusUnprocessableEntity, rr.Body)
+	}
+
+	_, _, err = app.verifySignedToken(rotated)
+	if !errors.Is(err, jwt.ErrInvalidToken) {
+		t.Errorf("got error %v for the token issued before the reuse; want %v", err, jwt.ErrInvalidToken)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"github.com/hayohtee/greenlight/internal/data"
+	"github.com/hayohtee/greenlight/internal/totp"
+	"github.com/hayohtee/greenlight/internal/validator"
+	"net/http"
+	"time"
+)
+
+// enableTwoFactorHandler starts the TOTP enrolment of the user, returning the secret
+// to add to an authenticator app. Two-factor authentication is only enabled once the
+// user confirms it with a code.
+func (app *application) enableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if app.twoFactorCipher == nil {
+		app.twoFactorUnavailableResponse(w, r)
+		return
+	}
+
+	// Read the user from the database, as the one in the request context only has its
+	// ID when authenticated with a signed token.
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	encrypted, err := app.twoFactorCipher.Encrypt([]byte(secret))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.TwoFactor.Enrol(user.ID, encrypted)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTwoFactorEnabled):
+			v := validator.New()
+			v.AddError("two_factor", "is already enabled")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{"two_factor": envelope{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(app.config.twoFactor.issuer, user.Email, secret),
+	}}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// confirmTwoFactorHandler enables two-factor authentication once the user provides a
+// code from their authenticator app, returning the recovery codes.
+func (app *application) confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if app.twoFactorCipher == nil {
+		app.twoFactorUnavailableResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(validator.Matches(input.Code, data.TOTPCodeRX), "code", "must be a 6 digits code")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	twoFactor, err := app.models.TwoFactor.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	switch {
+	case twoFactor == nil:
+		v.AddError("two_factor", "must be enabled first")
+	case twoFactor.Enabled():
+		v.AddError("two_factor", "is already enabled")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	secret, err := app.twoFactorCipher.Decrypt(twoFactor.Secret)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	step, ok := totp.Validate(string(secret), input.Code, time.Now(), 1)
+	if !ok {
+		v.AddError("code", "invalid code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	codes, err := app.models.TwoFactor.Confirm(user.ID, step)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			// The enrolment was confirmed or replaced by a concurrent request.
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// This is the only response which includes the recovery codes.
+	err = app.writeJSON(w, http.StatusOK, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// disableTwoFactorHandler disables two-factor authentication, which requires the
+// password of the user and a valid code so that a stolen session can't be used to
+// weaken the account. Both are subject to the same delays and lockouts as logins, and
+// the session is revoked after too many invalid codes, as the challenge token of a
+// login would be.
+func (app *application) disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Password != "", "password", "must be provided")
+	data.ValidateTwoFactorCode(v, input.Code)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Read the user from the database, as the one in the request context only has its
+	// ID when authenticated with a signed token.
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	match, retryAfter, err := app.verifyPassword(r, user, input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if retryAfter > 0 {
+		app.loginThrottledResponse(w, r, retryAfter)
+		return
+	}
+
+	if !match {
+		v.AddError("password", "is incorrect")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ok, err := app.verifyTwoFactorCode(user.ID, input.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !ok {
+		err = app.recordLoginFailure(user.Email, app.clientIP(r), user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// The route rejects API keys, so the request was authenticated with a session.
+		if session := app.contextGetSession(r); session != nil {
+			attempts, err := app.models.Tokens.RecordFailedSessionAttempt(user.ID, session.ID)
+			if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			if attempts >= twoFactorMaxAttempts {
+				err = app.revokeSession(user.ID, session.ID)
+				if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+					app.serverErrorResponse(w, r, err)
+					return
+				}
+				v.AddError("authentication_token", "too many invalid codes, log in again")
+			}
+		}
+
+		v.AddError("code", "invalid code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.TwoFactor.Delete(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "two-factor authentication successfully disabled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// verifyTwoFactorCode checks a code from the authenticator app or a recovery code of
+// the user, consuming it so that it can't be used again. It returns ErrRecordNotFound
+// if the user hasn't enabled two-factor authentication.
+func (app *application) verifyTwoFactorCode(userID int64, code string) (bool, error) {
+	twoFactor, err := app.models.TwoFactor.Get(userID)
+	if err != nil {
+		return false, err
+	}
+
+	if !twoFactor.Enabled() {
+		return false, data.ErrRecordNotFound
+	}
+
+	if !validator.Matches(code, data.TOTPCodeRX) {
+		return app.models.TwoFactor.UseRecoveryCode(userID, code)
+	}
+
+	if app.twoFactorCipher == nil {
+		return false, errors.New("two-factor authentication is enabled for a user but no encryption key is configured")
+	}
+
+	secret, err := app.twoFactorCipher.Decrypt(twoFactor.Secret)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := totp.Validate(string(secret), code, time.Now(), 1)
+	if !ok {
+		return false, nil
+	}
+
+	return app.models.TwoFactor.UseStep(userID, step)
+}
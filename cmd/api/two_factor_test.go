@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hayohtee/greenlight/internal/data"
+	"github.com/hayohtee/greenlight/internal/encryption"
+	"github.com/hayohtee/greenlight/internal/totp"
+)
+
+// enableTwoFactor sets up the two-factor encryption of the application and enables
+// two-factor authentication for the user, returning the TOTP secret.
+func enableTwoFactor(t *testing.T, app *application, user *data.User) string {
+	t.Helper()
+
+	cipher, err := encryption.New(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.twoFactorCipher = cipher
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := cipher.Encrypt([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.models.TwoFactor.Enrol(user.ID, encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Confirm with a past step, so that the current codes can still be used.
+	_, err = app.models.TwoFactor.Confirm(user.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return secret
+}
+
+// invalidCode returns a code which isn't valid for the secret at the moment.
+func invalidCode(t *testing.T, secret string) string {
+	t.Helper()
+
+	for _, code := range []string{"000000", "111111", "222222", "333333"} {
+		if _, ok := totp.Validate(secret, code, time.Now(), 1); !ok {
+			return code
+		}
+	}
+
+	t.Fatal("no invalid code found")
+	return ""
+}
+
+// disableTwoFactor sends the password and code to disable two-factor authentication
+// from the session of the user.
+func disableTwoFactor(t *testing.T, app *application, user *data.User, session *data.Session, ip, password, code string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	js, err := json.Marshal(map[string]string{"password": password, "code": code})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodDelete, "/v1/users/me/2fa", bytes.NewReader(js))
+	r.RemoteAddr = ip + ":4321"
+	r = app.contextSetup(r, &data.User{ID: user.ID, Activated: true})
+	r = app.contextSetSession(r, session)
+
+	rr := httptest.NewRecorder()
+	app.disableTwoFactorHandler(rr, r)
+	return rr
+}
+
+func TestDisableTwoFactorRequiresPassword(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.login.lockoutThreshold = 1
+
+	user := insertTestUser(t, app, "pa55word1234")
+	secret := enableTwoFactor(t, app, user)
+	session := &data.Session{ID: 1}
+	ip := uniqueIP(t, app)
+
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := disableTwoFactor(t, app, user, session, ip, "wrong-password", code)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d; want %d: %s", rr.Code, http.StatusUnprocessableEntity, rr.Body)
+	}
+
+	// The wrong password locked the account out, as a failed login would have.
+	rr = disableTwoFactor(t, app, user, session, ip, "pa55word1234", code)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d; want %d: %s", rr.Code, http.StatusTooManyRequests, rr.Body)
+	}
+
+	twoFactor, err := app.models.TwoFactor.Get(user.ID)
+	if err != nil || !twoFactor.Enabled() {
+		t.Errorf("got two-factor authentication %+v, error %v; want it still enabled", twoFactor, err)
+	}
+}
+
+func TestDisableTwoFactorRevokesSessionAfterInvalidCodes(t *testing.T) {
+	app := newTestApplication(t)
+
+	user := insertTestUser(t, app, "pa55word1234")
+	secret := enableTwoFactor(t, app, user)
+	ip := uniqueIP(t, app)
+
+	token, _, err := app.models.Tokens.NewSession(user.ID, time.Hour, time.Hour, ip, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := &data.Session{ID: token.ID}
+
+	for i := range twoFactorMaxAttempts {
+		rr := disableTwoFactor(t, app, user, session, ip, "pa55word1234", invalidCode(t, secret))
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("got status %d for attempt %d; want %d: %s", rr.Code, i+1, http.StatusUnprocessableEntity, rr.Body)
+		}
+	}
+
+	sessions, err := app.models.Tokens.GetSessionsForUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("got %d sessions after %d invalid codes; want none", len(sessions), twoFactorMaxAttempts)
+	}
+}
+
+func TestRequirePermissionTwoFactor(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.twoFactor.requiredPermissions = []string{"movies:write"}
+
+	user := insertTestUser(t, app, "pa55word1234")
+
+	request := func() int {
+		r := httptest.NewRequest(http.MethodPost, "/v1/movies", nil)
+		r = app.contextSetup(r, user)
+		r = app.contextSetPermissions(r, data.Permissions{"movies:read", "movies:write"})
+
+		rr := httptest.NewRecorder()
+		app.requirePermission("movies:write", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})(rr, r)
+		return rr.Code
+	}
+
+	// Nothing is required while two-factor authentication is unavailable.
+	if code := request(); code != http.StatusNoContent {
+		t.Errorf("got status %d without two-factor encryption; want %d", code, http.StatusNoContent)
+	}
+
+	cipher, err := encryption.New(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.twoFactorCipher = cipher
+
+	if code := request(); code != http.StatusForbidden {
+		t.Errorf("got status %d without two-factor authentication; want %d", code, http.StatusForbidden)
+	}
+
+	enableTwoFactor(t, app, user)
+
+	if code := request(); code != http.StatusNoContent {
+		t.Errorf("got status %d with two-factor authentication; want %d", code, http.StatusNoContent)
+	}
+}
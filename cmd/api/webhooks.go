@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hayohtee/greenlight/internal/data"
+	"github.com/hayohtee/greenlight/internal/validator"
+	"github.com/hayohtee/greenlight/internal/webhook"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Secret string   `json:"secret"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	webhook := &data.Webhook{
+		UserID: app.contextGetUser(r).ID,
+		URL:    input.URL,
+		Events: input.Events,
+		Secret: input.Secret,
+		Active: true,
+	}
+
+	// Generate a secret if the client didn't provide one.
+	if webhook.Secret == "" {
+		webhook.Secret, err = data.GenerateWebhookSecret()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	v := validator.New()
+	if data.ValidateWebhook(v, webhook); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Webhooks.Insert(webhook)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/webhooks/%d", webhook.ID))
+
+	// This is the only response which includes the secret.
+	err = app.writeJSON(w, http.StatusCreated, envelope{"webhook": webhook}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Sort = app.readString(qs, "sort", "id")
+	input.SortSafeList = []string{"id", "url", "created_at", "-id", "-url", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	webhooks, metadata, err := app.models.Webhooks.GetAllForUser(app.contextGetUser(r).ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"webhooks": webhooks, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.readOwnedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	webhook.Secret = ""
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"webhook": webhook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.readOwnedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		URL    *string  `json:"url"`
+		Events []string `json:"events"`
+		Secret *string  `json:"secret"`
+		Active *bool    `json:"active"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.URL != nil {
+		webhook.URL = *input.URL
+	}
+	if input.Events != nil {
+		webhook.Events = input.Events
+	}
+	if input.Secret != nil {
+		webhook.Secret = *input.Secret
+	}
+	if input.Active != nil {
+		webhook.Active = *input.Active
+	}
+
+	v := validator.New()
+	if data.ValidateWebhook(v, webhook); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Webhooks.Update(webhook)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	webhook.Secret = ""
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"webhook": webhook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.readOwnedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Webhooks.Delete(webhook.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "webhook deleted successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.readOwnedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Status string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Status = app.readString(qs, "status", "")
+	v.Check(
+		input.Status == "" || validator.PermittedValue(input.Status, data.DeliveryStatusPending, data.DeliveryStatusSucceeded, data.DeliveryStatusFailed),
+		"status",
+		"must be one of pending, succeeded or failed",
+	)
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Sort = app.readString(qs, "sort", "-id")
+	input.SortSafeList = []string{"id", "created_at", "attempts", "-id", "-created_at", "-attempts"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	deliveries, metadata, err := app.models.Webhooks.GetDeliveries(webhook.ID, input.Status, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"deliveries": deliveries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readOwnedWebhook fetches the webhook identified by the "id" URL parameter and
+// checks that it belongs to the current user. If it doesn't, or anything else goes
+// wrong, an error response is sent to the client and false is returned.
+func (app *application) readOwnedWebhook(w http.ResponseWriter, r *http.Request) (*data.Webhook, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	webhook, err := app.models.Webhooks.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if webhook.UserID != app.contextGetUser(r).ID {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	return webhook, true
+}
+
+// publishEvent queues a delivery of the event to every subscribed webhook. A failure
+// to queue the event is logged rather than failing the request which triggered it.
+func (app *application) publishEvent(event string, payload envelope) {
+	err := app.models.Webhooks.Enqueue(event, payload)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"event": event})
+	}
+}
+
+// deliverWebhooksPeriodically launches a background goroutine which polls the
+// delivery queue once every poll interval and sends the due deliveries.
+func (app *application) deliverWebhooksPeriodically() {
+	if app.config.webhooks.pollInterval <= 0 {
+		return
+	}
+
+	app.periodically(app.config.webhooks.pollInterval, func() {
+		err := app.deliverWebhooks()
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"task": "deliver webhooks"})
+		}
+	})
+}
+
+// deliverWebhooks claims a batch of due deliveries and sends them concurrently,
+// recording the outcome of each attempt.
+func (app *application) deliverWebhooks() error {
+	// Lease the deliveries for longer than it can take to send them, so that
+	// they are only picked up again if this instance dies in the meantime.
+	lease := app.config.webhooks.timeout + 30*time.Second
+
+	deliveries, err := app.models.Webhooks.ClaimDue(20, lease)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery *data.WebhookDelivery) {
+			defer wg.Done()
+			app.deliverWebhook(delivery)
+		}(delivery)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// deliverWebhook sends a single delivery, then either marks it as succeeded or
+// schedules a retry with exponential backoff until the maximum number of attempts
+// is reached.
+func (app *application) deliverWebhook(delivery *data.WebhookDelivery) {
+	body, err := json.Marshal(envelope{
+		"id":         delivery.ID,
+		"event":      delivery.Event,
+		"created_at": delivery.CreatedAt,
+		"data":       delivery.Payload,
+	})
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	status, err := app.webhooks.Send(delivery.URL, delivery.Secret, delivery.Event, delivery.ID, body)
+	delivery.ResponseStatus = status
+
+	switch {
+	case err == nil:
+		delivery.Status = data.DeliveryStatusSucceeded
+		delivery.LastError = ""
+	case delivery.Attempts >= app.config.webhooks.maxAttempts:
+		delivery.Status = data.DeliveryStatusFailed
+		delivery.LastError = err.Error()
+	default:
+		delivery.NextAttemptAt = time.Now().Add(webhook.Backoff(delivery.Attempts))
+		delivery.LastError = err.Error()
+	}
+
+	err = app.models.Webhooks.RecordAttempt(delivery)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{
+			"delivery_id": strconv.FormatInt(delivery.ID, 10),
+		})
+	}
+}
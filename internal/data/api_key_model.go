@@ -0,0 +1,174 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+// APIKeyModel is a struct that wraps a sql.DB connection pool and provides methods
+// for interacting with the api_keys table in the database.
+type APIKeyModel struct {
+	DB *sql.DB
+}
+
+// New generates a new API key for the user, inserts it into the database and sets
+// its plaintext key, which can't be retrieved afterwards.
+func (m APIKeyModel) New(key *APIKey) error {
+	err := key.generateSecret()
+	if err != nil {
+		return err
+	}
+
+	if key.AllowedIPs == nil {
+		key.AllowedIPs = []string{}
+	}
+
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, hash, permissions, allowed_ips)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	args := []any{key.UserID, key.Name, key.Prefix, key.Hash, pq.Array(key.Permissions), pq.Array(key.AllowedIPs)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+}
+
+// GetAllForUser returns the API keys owned by a specific user, most recent first.
+func (m APIKeyModel) GetAllForUser(userID int64) ([]*APIKey, error) {
+	query := `
+		SELECT id, created_at, user_id, name, prefix, permissions, allowed_ips, last_used_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		var key APIKey
+
+		err := rows.Scan(
+			&key.ID,
+			&key.CreatedAt,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			pq.Array(&key.Permissions),
+			pq.Array(&key.AllowedIPs),
+			&key.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Rotate replaces the secret of the API key with the given ID, if it belongs to the
+// given user, returning the key with its new plaintext key. The previous key stops
+// working immediately.
+func (m APIKeyModel) Rotate(id, userID int64) (*APIKey, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	key := APIKey{ID: id, UserID: userID}
+
+	err := key.generateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE api_keys
+		SET prefix = $1, hash = $2, last_used_at = NULL
+		WHERE id = $3 AND user_id = $4
+		RETURNING created_at, name, permissions, allowed_ips`
+
+	args := []any{key.Prefix, key.Hash, id, userID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&key.CreatedAt,
+		&key.Name,
+		pq.Array(&key.Permissions),
+		pq.Array(&key.AllowedIPs),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &key, nil
+}
+
+// Delete revokes the API key with the given ID, if it belongs to the given user.
+func (m APIKeyModel) Delete(id, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM api_keys
+		WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Touch records that the API key with the given ID was just used.
+func (m APIKeyModel) Touch(id int64) error {
+	query := `
+		UPDATE api_keys
+		SET last_used_at = NOW()
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
@@ -0,0 +1,115 @@
+package data
+
+import (
+	"crypto/sha256"
+	"github.com/hayohtee/greenlight/internal/validator"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// apiKeyPrefix starts every API key, which makes them easy to recognize, for example
+// by secret scanners.
+const apiKeyPrefix = "gl_"
+
+// APIKey is a type that represent a long-lived key used by a machine-to-machine client
+// to act on behalf of its owner. Permissions restricts the key to a subset of the owner's
+// permissions, and AllowedIPs, when not empty, restricts the addresses it can be used
+// from. The plaintext key is only set when the key is created or rotated.
+type APIKey struct {
+	ID          int64      `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UserID      int64      `json:"-"`
+	Name        string     `json:"name"`
+	Key         string     `json:"key,omitempty"`
+	Prefix      string     `json:"prefix"`
+	Hash        []byte     `json:"-"`
+	Permissions []string   `json:"permissions"`
+	AllowedIPs  []string   `json:"allowed_ips"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+}
+
+// generateSecret sets a new random plaintext key, along with its hash and the prefix
+// shown to identify the key.
+func (k *APIKey) generateSecret() error {
+	secret, err := randomString()
+	if err != nil {
+		return err
+	}
+
+	k.Key = apiKeyPrefix + secret
+	k.Prefix = k.Key[:len(apiKeyPrefix)+6]
+
+	hash := sha256.Sum256([]byte(k.Key))
+	k.Hash = hash[:]
+	return nil
+}
+
+// NeedsTouch reports whether the last used time of the key is stale enough to be
+// updated, which is only done once a minute to avoid a write on every request.
+func (k *APIKey) NeedsTouch() bool {
+	return k.LastUsedAt == nil || time.Since(*k.LastUsedAt) > time.Minute
+}
+
+// AllowsIP reports whether the key can be used from the given address.
+func (k *APIKey) AllowsIP(ip string) bool {
+	if len(k.AllowedIPs) == 0 {
+		return true
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, allowed := range k.AllowedIPs {
+		prefix, err := ParseIPPrefix(allowed)
+		if err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseIPPrefix parses a CIDR block, or a single address as the block of that address
+// only.
+func ParseIPPrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// ValidateAPIKey adds validation check on the API key. The permissions of the key must
+// be a subset of the owner's permissions.
+func ValidateAPIKey(v *validator.Validator, key *APIKey, ownerPermissions Permissions) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(key.Permissions != nil, "permissions", "must be provided")
+	v.Check(len(key.Permissions) >= 1, "permissions", "must contain at least 1 permission")
+	v.Check(validator.Unique(key.Permissions), "permissions", "must not contain duplicate values")
+	for _, code := range key.Permissions {
+		v.Check(ownerPermissions.Include(code), "permissions", "contains a permission you don't have "+code)
+	}
+
+	v.Check(len(key.AllowedIPs) <= 20, "allowed_ips", "must not contain more than 20 entries")
+	v.Check(validator.Unique(key.AllowedIPs), "allowed_ips", "must not contain duplicate values")
+	for _, ip := range key.AllowedIPs {
+		_, err := ParseIPPrefix(ip)
+		v.Check(err == nil, "allowed_ips", "contains an invalid IP address or CIDR block "+ip)
+	}
+}
+
+// ValidateAPIKeyPlainText checks that the plaintext API key has the expected format.
+func ValidateAPIKeyPlainText(v *validator.Validator, key string) {
+	v.Check(key != "", "key", "must be provided")
+	v.Check(strings.HasPrefix(key, apiKeyPrefix) && len(key) == len(apiKeyPrefix)+26, "key", "must be a valid API key")
+}
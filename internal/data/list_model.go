@@ -0,0 +1,438 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrDuplicateListItem is a custom error that represent a movie added twice to the same list.
+var ErrDuplicateListItem = errors.New("duplicate list item")
+
+// ListModel is a struct that wraps a sql.DB connection pool and provides methods
+// for interacting with the lists and list_items tables in the database.
+type ListModel struct {
+	DB *sql.DB
+}
+
+// Insert a new list into the database, generating a new share token for it.
+func (m ListModel) Insert(list *List) error {
+	err := list.RegenerateShareToken()
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO lists (user_id, name, description, visibility, share_token)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, version`
+
+	args := []any{list.UserID, list.Name, list.Description, list.Visibility, list.ShareToken}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&list.ID, &list.CreatedAt, &list.Version)
+}
+
+// Get a specific list from the database or return an error.
+func (m ListModel) Get(id int64) (*List, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, user_id, name, description, visibility, share_token, version
+		FROM lists
+		WHERE id = $1`
+
+	return m.get(query, id)
+}
+
+// GetByShareToken retrieve a specific list from the database based on its share token.
+func (m ListModel) GetByShareToken(shareToken string) (*List, error) {
+	query := `
+		SELECT id, created_at, user_id, name, description, visibility, share_token, version
+		FROM lists
+		WHERE share_token = $1`
+
+	return m.get(query, shareToken)
+}
+
+// get runs the given single-row list query and scans the result into a List struct.
+func (m ListModel) get(query string, args ...any) (*List, error) {
+	var list List
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&list.ID,
+		&list.CreatedAt,
+		&list.UserID,
+		&list.Name,
+		&list.Description,
+		&list.Visibility,
+		&list.ShareToken,
+		&list.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &list, nil
+}
+
+// GetAllForUser returns the lists owned by a specific user matching the filters.
+func (m ListModel) GetAllForUser(userID int64, filters Filters) ([]*List, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, user_id, name, description, visibility, share_token, version
+		FROM lists
+		WHERE user_id = $1
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	lists := []*List{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var list List
+		err := rows.Scan(
+			&totalRecords,
+			&list.ID,
+			&list.CreatedAt,
+			&list.UserID,
+			&list.Name,
+			&list.Description,
+			&list.Visibility,
+			&list.ShareToken,
+			&list.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		lists = append(lists, &list)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return lists, metadata, nil
+}
+
+// Update the details for a specific list.
+func (m ListModel) Update(list *List) error {
+	query := `
+		UPDATE lists
+		SET name = $1, description = $2, visibility = $3, share_token = $4, version = version + 1
+		WHERE id = $5 AND version = $6
+		RETURNING version`
+
+	args := []any{list.Name, list.Description, list.Visibility, list.ShareToken, list.ID, list.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&list.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete a specific list from the database or return an error.
+func (m ListModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM lists
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetItems returns all the items of a specific list in order.
+func (m ListModel) GetItems(listID int64) ([]*ListItem, error) {
+	query := `
+		SELECT list_items.list_id, list_items.movie_id, movies.title, movies.year,
+		       list_items.position, list_items.notes, list_items.added_at
+		FROM list_items
+		INNER JOIN movies ON movies.id = list_items.movie_id
+		WHERE list_items.list_id = $1
+		ORDER BY list_items.position ASC, list_items.movie_id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, listID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	items := []*ListItem{}
+	for rows.Next() {
+		var item ListItem
+		err := rows.Scan(
+			&item.ListID,
+			&item.MovieID,
+			&item.Title,
+			&item.Year,
+			&item.Position,
+			&item.Notes,
+			&item.AddedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// AddItem adds a movie to a list. If the item position is zero the movie is appended
+// to the end of the list, otherwise the items at or after the position are shifted
+// down to make room for it.
+func (m ListModel) AddItem(item *ListItem) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	last, err := lockListItems(ctx, tx, item.ListID)
+	if err != nil {
+		return err
+	}
+
+	if item.Position < 1 || item.Position > last+1 {
+		item.Position = last + 1
+	}
+
+	query := `
+		UPDATE list_items
+		SET position = position + 1
+		WHERE list_id = $1 AND position >= $2`
+
+	_, err = tx.ExecContext(ctx, query, item.ListID, item.Position)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		WITH inserted AS (
+			INSERT INTO list_items (list_id, movie_id, position, notes)
+			VALUES ($1, $2, $3, $4)
+			RETURNING movie_id, added_at
+		)
+		SELECT movies.title, movies.year, inserted.added_at
+		FROM inserted
+		INNER JOIN movies ON movies.id = inserted.movie_id`
+
+	args := []any{item.ListID, item.MovieID, item.Position, item.Notes}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&item.Title, &item.Year, &item.AddedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "list_items_pkey"`:
+			return ErrDuplicateListItem
+		case err.Error() == `pq: insert or update on table "list_items" violates foreign key constraint "list_items_movie_id_fkey"`:
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UpdateItem saves the notes of a list item and moves it to the item position,
+// shifting the items in between accordingly. A zero position keeps the item where it is.
+func (m ListModel) UpdateItem(item *ListItem) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	last, err := lockListItems(ctx, tx, item.ListID)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	query := `
+		SELECT position
+		FROM list_items
+		WHERE list_id = $1 AND movie_id = $2`
+
+	err = tx.QueryRowContext(ctx, query, item.ListID, item.MovieID).Scan(&current)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	switch {
+	case item.Position < 1:
+		item.Position = current
+	case item.Position > last:
+		item.Position = last
+	}
+
+	switch {
+	case item.Position < current:
+		query = `
+			UPDATE list_items
+			SET position = position + 1
+			WHERE list_id = $1 AND position >= $2 AND position < $3`
+		_, err = tx.ExecContext(ctx, query, item.ListID, item.Position, current)
+	case item.Position > current:
+		query = `
+			UPDATE list_items
+			SET position = position - 1
+			WHERE list_id = $1 AND position > $2 AND position <= $3`
+		_, err = tx.ExecContext(ctx, query, item.ListID, current, item.Position)
+	}
+	if err != nil {
+		return err
+	}
+
+	query = `
+		UPDATE list_items
+		SET position = $1, notes = $2
+		FROM movies
+		WHERE list_items.list_id = $3 AND list_items.movie_id = $4 AND movies.id = list_items.movie_id
+		RETURNING movies.title, movies.year, list_items.added_at`
+
+	args := []any{item.Position, item.Notes, item.ListID, item.MovieID}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&item.Title, &item.Year, &item.AddedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteItem removes a movie from a list, closing the gap it leaves in the ordering.
+func (m ListModel) DeleteItem(listID, movieID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = lockListItems(ctx, tx, listID)
+	if err != nil {
+		return err
+	}
+
+	var position int
+	query := `
+		DELETE FROM list_items
+		WHERE list_id = $1 AND movie_id = $2
+		RETURNING position`
+
+	err = tx.QueryRowContext(ctx, query, listID, movieID).Scan(&position)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	query = `
+		UPDATE list_items
+		SET position = position - 1
+		WHERE list_id = $1 AND position > $2`
+
+	_, err = tx.ExecContext(ctx, query, listID, position)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lockListItems locks the list row for the rest of the transaction, so that concurrent
+// changes to the ordering of its items are serialized, and returns the last position
+// currently in use.
+func lockListItems(ctx context.Context, tx *sql.Tx, listID int64) (int, error) {
+	_, err := tx.ExecContext(ctx, `SELECT id FROM lists WHERE id = $1 FOR UPDATE`, listID)
+	if err != nil {
+		return 0, err
+	}
+
+	var last int
+	query := `
+		SELECT COALESCE(MAX(position), 0)
+		FROM list_items
+		WHERE list_id = $1`
+
+	err = tx.QueryRowContext(ctx, query, listID).Scan(&last)
+	return last, err
+}
@@ -0,0 +1,90 @@
+package data
+
+import (
+	"github.com/hayohtee/greenlight/internal/validator"
+	"time"
+)
+
+// Define constants for the list visibility.
+const (
+	// ListVisibilityPrivate represents a list only visible to its owner.
+	ListVisibilityPrivate = "private"
+	// ListVisibilityUnlisted represents a list visible to anyone holding its share token.
+	ListVisibilityUnlisted = "unlisted"
+	// ListVisibilityPublic represents a list visible to everyone.
+	ListVisibilityPublic = "public"
+)
+
+// List is a type that represent a named, ordered collection of movies curated by a user.
+type List struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UserID      int64       `json:"-"`
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Visibility  string      `json:"visibility"`
+	ShareToken  string      `json:"share_token,omitempty"`
+	Items       []*ListItem `json:"items,omitempty"`
+	Version     int32       `json:"version"`
+}
+
+// ListItem is a type that represent a single movie entry within a list.
+type ListItem struct {
+	ListID   int64     `json:"-"`
+	MovieID  int64     `json:"movie_id"`
+	Title    string    `json:"title"`
+	Year     int32     `json:"year,omitempty"`
+	Position int       `json:"position"`
+	Notes    string    `json:"notes,omitempty"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+// IsOwnedBy check if the list belongs to the given user.
+func (l *List) IsOwnedBy(user *User) bool {
+	return !user.IsAnonymous() && l.UserID == user.ID
+}
+
+// IsVisibleTo check if the given user is allowed to view the list when looking it
+// up by its ID. Unlisted lists are only reachable through their share token.
+func (l *List) IsVisibleTo(user *User) bool {
+	return l.Visibility == ListVisibilityPublic || l.IsOwnedBy(user)
+}
+
+// RegenerateShareToken replaces the share token of the list with a new one, so
+// that previously shared links stop working once the list is saved.
+func (l *List) RegenerateShareToken() error {
+	shareToken, err := randomString()
+	if err != nil {
+		return err
+	}
+	l.ShareToken = shareToken
+	return nil
+}
+
+// ValidateList adds validation check on the list.
+func ValidateList(v *validator.Validator, list *List) {
+	v.Check(list.Name != "", "name", "must be provided")
+	v.Check(len(list.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	v.Check(len(list.Description) <= 2000, "description", "must not be more than 2000 bytes long")
+
+	v.Check(
+		validator.PermittedValue(list.Visibility, ListVisibilityPrivate, ListVisibilityUnlisted, ListVisibilityPublic),
+		"visibility",
+		"must be one of private, unlisted or public",
+	)
+}
+
+// ValidateListItem adds validation check on the list item.
+func ValidateListItem(v *validator.Validator, item *ListItem) {
+	v.Check(item.MovieID > 0, "movie_id", "must be provided")
+	v.Check(item.Position >= 0, "position", "must not be negative")
+	v.Check(len(item.Notes) <= 2000, "notes", "must not be more than 2000 bytes long")
+}
+
+// ValidateShareToken check that the share token has been provided and
+// is exactly 26 bytes long.
+func ValidateShareToken(v *validator.Validator, shareToken string) {
+	v.Check(shareToken != "", "token", "must be provided")
+	v.Check(len(shareToken) == 26, "token", "must be 26 bytes long")
+}
@@ -0,0 +1,112 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// LoginFailureModel is a struct that wraps a sql.DB connection pool and provides
+// methods for interacting with the login failure counters in the database.
+type LoginFailureModel struct {
+	DB *sql.DB
+}
+
+// Get returns the login failure counters with the given keys, by kind, skipping the
+// ones which don't exist.
+func (m LoginFailureModel) Get(accountKey, ip string) (map[string]*LoginFailure, error) {
+	query := `
+		SELECT kind, key, failures, last_failed_at, locked_until
+		FROM login_failures
+		WHERE (kind = $1 AND key = $2) OR (kind = $3 AND key = $4)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, LoginFailureAccount, accountKey, LoginFailureIP, ip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := make(map[string]*LoginFailure)
+
+	for rows.Next() {
+		var failure LoginFailure
+
+		err := rows.Scan(&failure.Kind, &failure.Key, &failure.Failures, &failure.LastFailedAt, &failure.LockedUntil)
+		if err != nil {
+			return nil, err
+		}
+
+		failures[failure.Kind] = &failure
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return failures, nil
+}
+
+// RecordFailure counts a failed login for the counter, starting over if the previous
+// failure is older than the window or the previous lockout has expired. The counter
+// is locked out for the given duration when it reaches the lockout threshold, in
+// which case locked is true for the single call which locked it.
+func (m LoginFailureModel) RecordFailure(kind, key string, window time.Duration, lockoutThreshold int, lockoutDuration time.Duration) (failure *LoginFailure, locked bool, err error) {
+	query := `
+		INSERT INTO login_failures (kind, key, failures, last_failed_at)
+		VALUES ($1, $2, 1, NOW())
+		ON CONFLICT (kind, key) DO UPDATE
+		SET failures = CASE
+				WHEN login_failures.last_failed_at < NOW() - make_interval(secs => $3)
+					OR login_failures.locked_until <= NOW() THEN 1
+				ELSE login_failures.failures + 1
+			END,
+			locked_until = CASE
+				WHEN login_failures.locked_until <= NOW() THEN NULL
+				ELSE login_failures.locked_until
+			END,
+			last_failed_at = NOW()
+		RETURNING failures, last_failed_at, locked_until`
+
+	failure = &LoginFailure{Kind: kind, Key: key}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, kind, key, window.Seconds()).Scan(&failure.Failures, &failure.LastFailedAt, &failure.LockedUntil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if lockoutThreshold <= 0 || failure.Failures != lockoutThreshold {
+		return failure, false, nil
+	}
+
+	query = `
+		UPDATE login_failures
+		SET locked_until = NOW() + make_interval(secs => $3)
+		WHERE kind = $1 AND key = $2
+		RETURNING locked_until`
+
+	err = m.DB.QueryRowContext(ctx, query, kind, key, lockoutDuration.Seconds()).Scan(&failure.LockedUntil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return failure, true, nil
+}
+
+// Reset deletes the login failure counter, unlocking it.
+func (m LoginFailureModel) Reset(kind, key string) error {
+	query := `
+		DELETE FROM login_failures
+		WHERE kind = $1 AND key = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, kind, key)
+	return err
+}
@@ -0,0 +1,72 @@
+package data
+
+import (
+	"strings"
+	"time"
+)
+
+// Define constants for the kinds of login failure counters.
+const (
+	LoginFailureAccount = "account"
+	LoginFailureIP      = "ip"
+)
+
+// LoginFailure is a type that represent the recent failed logins for an account or a
+// client IP address. LockedUntil is set once the lockout threshold is reached.
+type LoginFailure struct {
+	Kind         string
+	Key          string
+	Failures     int
+	LastFailedAt time.Time
+	LockedUntil  *time.Time
+}
+
+// LoginPolicy holds the thresholds applied to failed logins. Accounts get a delay
+// between attempts doubling from one second once DelayThreshold failures are reached,
+// and both accounts and IP addresses are locked out once their lockout threshold is
+// reached. Failures are forgotten after Window without any.
+type LoginPolicy struct {
+	DelayThreshold     int
+	MaxDelay           time.Duration
+	LockoutThreshold   int
+	IPLockoutThreshold int
+	LockoutDuration    time.Duration
+	Window             time.Duration
+}
+
+// AccountKey returns the key of the login failure counter of the email address.
+func AccountKey(email string) string {
+	return strings.ToLower(email)
+}
+
+// Locked reports whether the counter is locked out at the given time.
+func (f *LoginFailure) Locked(now time.Time) bool {
+	return f.LockedUntil != nil && f.LockedUntil.After(now)
+}
+
+// RetryAfter returns how long to wait before the next login attempt is allowed, zero
+// if it is allowed now.
+func (f *LoginFailure) RetryAfter(policy LoginPolicy, now time.Time) time.Duration {
+	if f.Locked(now) {
+		return f.LockedUntil.Sub(now)
+	}
+
+	// Expired lockouts and failures outside the window are reset by the next failure.
+	if f.LockedUntil != nil || now.Sub(f.LastFailedAt) > policy.Window {
+		return 0
+	}
+
+	if f.Kind != LoginFailureAccount || policy.DelayThreshold <= 0 || f.Failures < policy.DelayThreshold {
+		return 0
+	}
+
+	delay := policy.MaxDelay
+	if shift := f.Failures - policy.DelayThreshold; shift < 32 && time.Second<<shift < delay {
+		delay = time.Second << shift
+	}
+
+	if wait := f.LastFailedAt.Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
@@ -15,18 +15,38 @@ var (
 
 // Models is a struct that wraps all the database models.
 type Models struct {
-	Movies      MovieModel
-	Users       UserModel
-	Tokens      TokenModel
-	Permissions PermissionModel
+	Movies        MovieModel
+	Users         UserModel
+	Tokens        TokenModel
+	Permissions   PermissionModel
+	Lists         ListModel
+	Stats         StatsModel
+	Webhooks      WebhookModel
+	MovieEvents   MovieEventModel
+	APIKeys       APIKeyModel
+	TwoFactor     TwoFactorModel
+	OAuth         OAuthModel
+	OIDC          OIDCModel
+	LoginFailures LoginFailureModel
+	Roles         RoleModel
 }
 
 // NewModels returns an initialized Models struct.
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Movies:      MovieModel{DB: db},
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Permissions: PermissionModel{DB: db},
+		Movies:        MovieModel{DB: db},
+		Users:         UserModel{DB: db},
+		Tokens:        TokenModel{DB: db},
+		Permissions:   PermissionModel{DB: db},
+		Lists:         ListModel{DB: db},
+		Stats:         StatsModel{DB: db},
+		Webhooks:      WebhookModel{DB: db},
+		MovieEvents:   MovieEventModel{DB: db},
+		APIKeys:       APIKeyModel{DB: db},
+		TwoFactor:     TwoFactorModel{DB: db},
+		OAuth:         OAuthModel{DB: db},
+		OIDC:          OIDCModel{DB: db},
+		LoginFailures: LoginFailureModel{DB: db},
+		Roles:         RoleModel{DB: db},
 	}
 }
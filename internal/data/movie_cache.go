@@ -0,0 +1,138 @@
+package data
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// MovieCache is a bounded, in-process cache of movies keyed by ID. The least recently
+// used movie is evicted when the cache is full, and movies expire after the TTL so that
+// a missed invalidation only serves stale data for a bounded time.
+type MovieCache struct {
+	mu       sync.Mutex
+	size     int
+	ttl      time.Duration
+	order    *list.List
+	entries  map[int64]*list.Element
+	stats    MovieCacheStats
+	modified uint64
+}
+
+// MovieCacheStats holds the counters describing the cache efficiency.
+type MovieCacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Expired   uint64 `json:"expired"`
+	Entries   int    `json:"entries"`
+}
+
+type movieCacheEntry struct {
+	movie   Movie
+	expires time.Time
+}
+
+// NewMovieCache returns a cache holding up to size movies for the given TTL.
+func NewMovieCache(size int, ttl time.Duration) *MovieCache {
+	return &MovieCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[int64]*list.Element),
+	}
+}
+
+// get returns a copy of the cached movie with the given ID, if there is one. On a
+// miss, it also returns the modification counter of the cache, to pass to add.
+func (c *MovieCache) get(id int64) (*Movie, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[id]
+	if ok && time.Now().After(elem.Value.(*movieCacheEntry).expires) {
+		c.remove(elem)
+		c.stats.Expired++
+		ok = false
+	}
+
+	if !ok {
+		c.stats.Misses++
+		return nil, c.modified, false
+	}
+
+	c.stats.Hits++
+	c.order.MoveToFront(elem)
+	return copyMovie(&elem.Value.(*movieCacheEntry).movie), 0, true
+}
+
+// add stores a copy of the movie read from the database, unless the cache has been
+// invalidated since the movie was looked up in it, in which case the movie may be
+// stale already.
+func (c *MovieCache) add(movie *Movie, modified uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.modified != modified {
+		return
+	}
+
+	if elem, ok := c.entries[movie.ID]; ok {
+		c.remove(elem)
+	}
+
+	entry := &movieCacheEntry{movie: *copyMovie(movie), expires: time.Now().Add(c.ttl)}
+	c.entries[movie.ID] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+// Invalidate removes the movie with the given ID from the cache.
+func (c *MovieCache) Invalidate(id int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.modified++
+	if elem, ok := c.entries[id]; ok {
+		c.remove(elem)
+	}
+}
+
+// Purge removes every movie from the cache. It is used when invalidations may have
+// been missed, such as while the connection to the database was lost.
+func (c *MovieCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.modified++
+	c.order.Init()
+	c.entries = make(map[int64]*list.Element)
+}
+
+// Stats returns the current counters of the cache.
+func (c *MovieCache) Stats() MovieCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	return stats
+}
+
+func (c *MovieCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*movieCacheEntry).movie.ID)
+}
+
+// copyMovie returns a deep copy of the movie, so that callers modifying the movies
+// they get don't change the cached ones.
+func copyMovie(movie *Movie) *Movie {
+	c := *movie
+	if movie.Genres != nil {
+		c.Genres = append([]string(nil), movie.Genres...)
+	}
+	return &c
+}
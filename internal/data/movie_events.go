@@ -0,0 +1,160 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MovieEventsChannel is the Postgres notification channel on which the ID of every
+// new movie event is published, along with the ID of the changed movie.
+const MovieEventsChannel = "movie_events"
+
+// ParseMovieEventNotification returns the event ID and the movie ID carried by the
+// payload of a notification published on the MovieEventsChannel.
+func ParseMovieEventNotification(payload string) (eventID int64, movieID int64, err error) {
+	event, movie, ok := strings.Cut(payload, ",")
+	if !ok {
+		return 0, 0, errors.New("invalid movie event notification payload")
+	}
+
+	eventID, err = strconv.ParseInt(event, 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	movieID, err = strconv.ParseInt(movie, 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return eventID, movieID, nil
+}
+
+// MovieEvent is a type that represent a change made to the movies table. Movie is
+// the state of the movie after the change, and is nil for deleted movies.
+type MovieEvent struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Event     string    `json:"event"`
+	MovieID   int64     `json:"movie_id"`
+	Movie     *Movie    `json:"movie,omitempty"`
+}
+
+// MovieEventModel is a struct which wraps a sql.DB connection pool and provides
+// methods for reading the movie_events table.
+type MovieEventModel struct {
+	DB *sql.DB
+}
+
+// LatestID returns the ID of the most recent movie event, or zero if there is none.
+func (m MovieEventModel) LatestID() (int64, error) {
+	query := `
+		SELECT COALESCE(MAX(id), 0)
+		FROM movie_events`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	err := m.DB.QueryRowContext(ctx, query).Scan(&id)
+	return id, err
+}
+
+// GetAfter returns, in order, up to limit movie events recorded after the event with
+// the given ID. The trigger recording the events serializes the transactions which
+// record them, so an event can't become visible after one with a greater ID, and
+// none are skipped by reading from the last ID seen.
+func (m MovieEventModel) GetAfter(id int64, limit int) ([]*MovieEvent, error) {
+	query := `
+		SELECT id, created_at, event, movie_id, movie
+		FROM movie_events
+		WHERE id > $1
+		ORDER BY id ASC
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var events []*MovieEvent
+	for rows.Next() {
+		var event MovieEvent
+		var movie []byte
+
+		err := rows.Scan(&event.ID, &event.CreatedAt, &event.Event, &event.MovieID, &movie)
+		if err != nil {
+			return nil, err
+		}
+
+		if movie != nil {
+			event.Movie, err = decodeMovieRow(movie)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// DeleteOlderThan removes the movie events recorded before the given time.
+func (m MovieEventModel) DeleteOlderThan(t time.Time) error {
+	query := `
+		DELETE FROM movie_events
+		WHERE created_at < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, t)
+	return err
+}
+
+// decodeMovieRow decodes a movies table row, as encoded by the Postgres to_jsonb()
+// function, into a Movie struct. The runtime is stored as a plain integer there,
+// so it can't be decoded with the Runtime JSON format used by the API.
+func decodeMovieRow(js []byte) (*Movie, error) {
+	var row struct {
+		ID        int64     `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+		Title     string    `json:"title"`
+		Year      int32     `json:"year"`
+		Runtime   int32     `json:"runtime"`
+		Genres    []string  `json:"genres"`
+		Version   int32     `json:"version"`
+	}
+
+	err := json.Unmarshal(js, &row)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Movie{
+		ID:        row.ID,
+		CreatedAt: row.CreatedAt,
+		UpdatedAt: row.UpdatedAt,
+		Title:     row.Title,
+		Year:      row.Year,
+		Runtime:   Runtime(row.Runtime),
+		Genres:    row.Genres,
+		Version:   row.Version,
+	}, nil
+}
@@ -15,6 +15,8 @@ type Movie struct {
 	ID int64 `json:"id"`
 	// Timestamp for when the movie is added to the database.
 	CreatedAt time.Time `json:"-"`
+	// Timestamp for when the movie was last updated.
+	UpdatedAt time.Time `json:"-"`
 	// Movie title.
 	Title string `json:"title"`
 	// Movie release year.
@@ -48,6 +50,10 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 // MovieModel is a struct which wraps a sql.DB connection pool.
 type MovieModel struct {
 	DB *sql.DB
+	// Cache holds the movies read by Get, if it is set. Movies are invalidated on
+	// Update and Delete, and the other API instances invalidate their own cache
+	// when notified of the change.
+	Cache *MovieCache
 }
 
 // Insert a movie into the database.
@@ -55,12 +61,12 @@ func (m MovieModel) Insert(movie *Movie) error {
 	query := `
 		INSERT INTO movies (title, year, runtime, genres)
 		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at, version;`
+		RETURNING id, created_at, updated_at, version;`
 
 	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.UpdatedAt, &movie.Version)
 }
 
 // Get a specific movie from the database or return an error.
@@ -69,8 +75,17 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 		return nil, ErrRecordNotFound
 	}
 
+	var modified uint64
+	if m.Cache != nil {
+		movie, counter, ok := m.Cache.get(id)
+		if ok {
+			return movie, nil
+		}
+		modified = counter
+	}
+
 	query := `
-		SELECT id, created_at, title, year, runtime, genres, version
+		SELECT id, created_at, updated_at, title, year, runtime, genres, version
 		FROM movies
 		WHERE id = $1;`
 
@@ -84,6 +99,7 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
 		&movie.ID,
 		&movie.CreatedAt,
+		&movie.UpdatedAt,
 		&movie.Title,
 		&movie.Year,
 		&movie.Runtime,
@@ -99,6 +115,11 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 			return nil, err
 		}
 	}
+
+	if m.Cache != nil {
+		m.Cache.add(&movie, modified)
+	}
+
 	return &movie, nil
 }
 
@@ -106,15 +127,21 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 func (m MovieModel) Update(movie *Movie) error {
 	query := `
 		UPDATE movies
-		SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
+		SET title = $1, year = $2, runtime = $3, genres = $4, updated_at = NOW(), version = version + 1
 		WHERE id = $5 AND version = $6
-		RETURNING version;`
+		RETURNING updated_at, version;`
 
 	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ID, movie.Version}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	// Invalidate the cached movie whatever the outcome, an edit conflict means
+	// that it is stale too.
+	if m.Cache != nil {
+		defer m.Cache.Invalidate(movie.ID)
+	}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.UpdatedAt, &movie.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -139,6 +166,10 @@ func (m MovieModel) Delete(id int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	if m.Cache != nil {
+		defer m.Cache.Invalidate(id)
+	}
+
 	result, err := m.DB.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
@@ -163,7 +194,7 @@ func (m MovieModel) Delete(id int64) error {
 // GetAll returns list of all movies in the database matching the query parameters.
 func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
+		SELECT count(*) OVER(), id, created_at, updated_at, title, year, runtime, genres, version
 		FROM movies
 		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
 		AND (genres @> $2 OR $2 = '{}')
@@ -190,6 +221,7 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 			&totalRecords,
 			&movie.ID,
 			&movie.CreatedAt,
+			&movie.UpdatedAt,
 			&movie.Title,
 			&movie.Year,
 			&movie.Runtime,
@@ -210,3 +242,25 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
 	return movies, metadata, nil
 }
+
+// CatalogVersion returns the number of changes made to the movies table, and the time
+// of the last one. Any insert, update or delete increments the version, which makes it
+// suitable to validate cached responses listing movies.
+func (m MovieModel) CatalogVersion() (int64, time.Time, error) {
+	query := `
+		SELECT version, updated_at
+		FROM movies_catalog`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var version int64
+	var updatedAt time.Time
+
+	err := m.DB.QueryRowContext(ctx, query).Scan(&version, &updatedAt)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	return version, updatedAt, nil
+}
@@ -0,0 +1,139 @@
+package data
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"github.com/hayohtee/greenlight/internal/validator"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OAuthClient is a type that represent a third-party application registered to act on
+// behalf of the users who authorize it. Confidential clients authenticate with their
+// secret, while public clients, such as mobile apps, can't keep one and only rely on
+// PKCE. Scopes holds the permission codes the client may request.
+type OAuthClient struct {
+	ID           int64     `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UserID       int64     `json:"-"`
+	ClientID     string    `json:"client_id"`
+	Secret       string    `json:"client_secret,omitempty"`
+	SecretHash   []byte    `json:"-"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+}
+
+// generateCredentials sets a new client ID, and a new secret along with its hash for
+// confidential clients.
+func (c *OAuthClient) generateCredentials() error {
+	clientID, err := randomString()
+	if err != nil {
+		return err
+	}
+	c.ClientID = strings.ToLower(clientID)
+
+	if c.Confidential {
+		c.Secret, err = randomString()
+		if err != nil {
+			return err
+		}
+
+		hash := sha256.Sum256([]byte(c.Secret))
+		c.SecretHash = hash[:]
+	}
+
+	return nil
+}
+
+// SecretMatches reports whether the secret is the one of the client.
+func (c *OAuthClient) SecretMatches(secret string) bool {
+	if c.SecretHash == nil {
+		return false
+	}
+
+	hash := sha256.Sum256([]byte(secret))
+	return subtle.ConstantTimeCompare(hash[:], c.SecretHash) == 1
+}
+
+// AllowsRedirectURI reports whether the URI is one of the registered redirect URIs,
+// which must match exactly.
+func (c *OAuthClient) AllowsRedirectURI(uri string) bool {
+	for _, allowed := range c.RedirectURIs {
+		if uri == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// OAuthConsent is a type that represent the scopes a user granted to a client.
+type OAuthConsent struct {
+	ClientID   int64     `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// OAuthAuthorizationCode is a type that represent the code issued to a client once a
+// user authorized it, to exchange for tokens along with the PKCE code verifier.
+type OAuthAuthorizationCode struct {
+	PlainText     string
+	Hash          []byte
+	ClientID      int64
+	UserID        int64
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string
+	Expiry        time.Time
+}
+
+// ParseScope splits an OAuth scope parameter, a space separated list of permission
+// codes.
+func ParseScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+// VerifyCodeChallenge reports whether the PKCE code verifier matches the challenge,
+// using the S256 method which is the only one supported.
+func VerifyCodeChallenge(verifier, challenge string) bool {
+	hash := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(hash[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// ValidateOAuthClient adds validation check on the OAuth client. The scopes of the
+// client must be existing permission codes.
+func ValidateOAuthClient(v *validator.Validator, client *OAuthClient, permissionCodes Permissions) {
+	v.Check(client.Name != "", "name", "must be provided")
+	v.Check(len(client.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(len(client.RedirectURIs) >= 1, "redirect_uris", "must contain at least 1 URI")
+	v.Check(len(client.RedirectURIs) <= 10, "redirect_uris", "must not contain more than 10 URIs")
+	v.Check(validator.Unique(client.RedirectURIs), "redirect_uris", "must not contain duplicate values")
+	for _, uri := range client.RedirectURIs {
+		u, err := url.Parse(uri)
+		v.Check(err == nil && u.Scheme != "" && u.Fragment == "" && len(uri) <= 2000, "redirect_uris", "must contain absolute URIs without fragment")
+		// Only allow plain HTTP for local development.
+		if err == nil && u.Scheme == "http" {
+			v.Check(u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1" || u.Hostname() == "::1", "redirect_uris", "must use https, except for localhost")
+		}
+	}
+
+	v.Check(len(client.Scopes) >= 1, "scopes", "must contain at least 1 scope")
+	v.Check(validator.Unique(client.Scopes), "scopes", "must not contain duplicate values")
+	for _, scope := range client.Scopes {
+		v.Check(permissionCodes.Include(scope), "scopes", "contains an unknown scope "+scope)
+	}
+}
+
+// ValidateCodeChallenge checks that the PKCE code challenge is a S256 challenge.
+func ValidateCodeChallenge(v *validator.Validator, challenge, method string) {
+	v.Check(challenge != "", "code_challenge", "must be provided")
+	v.Check(len(challenge) == 43, "code_challenge", "must be a base64url encoded SHA-256 hash")
+	v.Check(method == "S256", "code_challenge_method", "must be S256")
+}
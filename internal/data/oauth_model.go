@@ -0,0 +1,344 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+// OAuthModel is a struct that wraps a sql.DB connection pool and provides methods for
+// interacting with the OAuth clients, consents and authorization codes in the database.
+type OAuthModel struct {
+	DB *sql.DB
+}
+
+// InsertClient generates the credentials of a new client and inserts it into the
+// database. The secret can't be retrieved afterwards.
+func (m OAuthModel) InsertClient(client *OAuthClient) error {
+	err := client.generateCredentials()
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO oauth_clients (user_id, client_id, secret_hash, name, redirect_uris, scopes)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	args := []any{client.UserID, client.ClientID, client.SecretHash, client.Name, pq.Array(client.RedirectURIs), pq.Array(client.Scopes)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&client.ID, &client.CreatedAt)
+}
+
+// GetClient returns the client with the given public client ID. The clients of
+// deactivated users, and of users whose deletion is scheduled, are ignored.
+func (m OAuthModel) GetClient(clientID string) (*OAuthClient, error) {
+	query := `
+		SELECT oauth_clients.id, oauth_clients.created_at, oauth_clients.user_id, oauth_clients.client_id,
+			oauth_clients.secret_hash, oauth_clients.name, oauth_clients.redirect_uris, oauth_clients.scopes
+		FROM oauth_clients
+		INNER JOIN users ON oauth_clients.user_id = users.id
+		WHERE oauth_clients.client_id = $1
+		AND NOT users.deactivated
+		AND NOT EXISTS (SELECT 1 FROM users_deletions WHERE users_deletions.user_id = users.id)`
+
+	var client OAuthClient
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, clientID).Scan(
+		&client.ID,
+		&client.CreatedAt,
+		&client.UserID,
+		&client.ClientID,
+		&client.SecretHash,
+		&client.Name,
+		pq.Array(&client.RedirectURIs),
+		pq.Array(&client.Scopes),
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	client.Confidential = client.SecretHash != nil
+	return &client, nil
+}
+
+// GetClientsForUser returns the clients registered by a specific user.
+func (m OAuthModel) GetClientsForUser(userID int64) ([]*OAuthClient, error) {
+	query := `
+		SELECT id, created_at, user_id, client_id, secret_hash IS NOT NULL, name, redirect_uris, scopes
+		FROM oauth_clients
+		WHERE user_id = $1
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	clients := []*OAuthClient{}
+	for rows.Next() {
+		var client OAuthClient
+
+		err := rows.Scan(
+			&client.ID,
+			&client.CreatedAt,
+			&client.UserID,
+			&client.ClientID,
+			&client.Confidential,
+			&client.Name,
+			pq.Array(&client.RedirectURIs),
+			pq.Array(&client.Scopes),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		clients = append(clients, &client)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+// DeleteClient deletes the client with the given ID if it was registered by the given
+// user, along with its consents, codes and tokens.
+func (m OAuthModel) DeleteClient(id, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM oauth_clients
+		WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GrantConsent records that the user granted the scopes to the client, in addition to
+// the ones granted before.
+func (m OAuthModel) GrantConsent(userID, clientID int64, scopes []string) error {
+	query := `
+		INSERT INTO oauth_consents (user_id, client_id, scopes)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, client_id) DO UPDATE
+		SET scopes = ARRAY(SELECT DISTINCT unnest(oauth_consents.scopes || EXCLUDED.scopes) ORDER BY 1),
+			updated_at = NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, clientID, pq.Array(scopes))
+	return err
+}
+
+// GetConsentsForUser returns the clients a specific user has authorized.
+func (m OAuthModel) GetConsentsForUser(userID int64) ([]*OAuthConsent, error) {
+	query := `
+		SELECT oauth_consents.client_id, oauth_clients.name, oauth_consents.scopes,
+			oauth_consents.created_at, oauth_consents.updated_at
+		FROM oauth_consents
+		INNER JOIN oauth_clients ON oauth_clients.id = oauth_consents.client_id
+		WHERE oauth_consents.user_id = $1
+		ORDER BY oauth_consents.updated_at DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	consents := []*OAuthConsent{}
+	for rows.Next() {
+		var consent OAuthConsent
+
+		err := rows.Scan(
+			&consent.ClientID,
+			&consent.ClientName,
+			pq.Array(&consent.Scopes),
+			&consent.CreatedAt,
+			&consent.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		consents = append(consents, &consent)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return consents, nil
+}
+
+// RevokeConsent deletes the consent of the user to the client, along with the tokens
+// and codes issued to the client on their behalf.
+func (m OAuthModel) RevokeConsent(userID, clientID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM oauth_consents
+		WHERE user_id = $1 AND client_id = $2`
+
+	result, err := tx.ExecContext(ctx, query, userID, clientID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	query = `
+		DELETE FROM tokens
+		WHERE user_id = $1 AND client_id = $2`
+
+	_, err = tx.ExecContext(ctx, query, userID, clientID)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		DELETE FROM oauth_authorization_codes
+		WHERE user_id = $1 AND client_id = $2`
+
+	_, err = tx.ExecContext(ctx, query, userID, clientID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// NewAuthorizationCode generates a new authorization code, inserts it into the
+// database and sets its plaintext.
+func (m OAuthModel) NewAuthorizationCode(code *OAuthAuthorizationCode, ttl time.Duration) error {
+	plainText, err := randomString()
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256([]byte(plainText))
+	code.PlainText = plainText
+	code.Hash = hash[:]
+	code.Expiry = time.Now().Add(ttl)
+
+	query := `
+		INSERT INTO oauth_authorization_codes (hash, client_id, user_id, redirect_uri, scopes, code_challenge, expiry)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	args := []any{code.Hash, code.ClientID, code.UserID, code.RedirectURI, pq.Array(code.Scopes), code.CodeChallenge, code.Expiry}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// ConsumeAuthorizationCode deletes the authorization code and returns it, so that it
+// can only be exchanged once. Expired codes are deleted at the same time. The codes of
+// users whose deletion is scheduled are ignored.
+func (m OAuthModel) ConsumeAuthorizationCode(plainText string) (*OAuthAuthorizationCode, error) {
+	hash := sha256.Sum256([]byte(plainText))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM oauth_authorization_codes
+		WHERE hash = $1
+		AND NOT EXISTS (SELECT 1 FROM users_deletions WHERE users_deletions.user_id = oauth_authorization_codes.user_id)
+		RETURNING client_id, user_id, redirect_uri, scopes, code_challenge, expiry`
+
+	code := OAuthAuthorizationCode{Hash: hash[:]}
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:]).Scan(
+		&code.ClientID,
+		&code.UserID,
+		&code.RedirectURI,
+		pq.Array(&code.Scopes),
+		&code.CodeChallenge,
+		&code.Expiry,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+		DELETE FROM oauth_authorization_codes
+		WHERE expiry <= $1`
+
+	_, err = m.DB.ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(code.Expiry) {
+		return nil, ErrRecordNotFound
+	}
+
+	return &code, nil
+}
@@ -0,0 +1,48 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"time"
+)
+
+// OIDCLogin is a type that represent a login started with the external OpenID Connect
+// provider. The state identifies it when the user comes back from the provider, the
+// nonce binds the ID token to it, and the code verifier is the PKCE secret.
+type OIDCLogin struct {
+	State        string
+	Hash         []byte
+	Nonce        string
+	CodeVerifier string
+	Expiry       time.Time
+}
+
+// UserIdentity is a type that represent the account of a user with the external
+// provider.
+type UserIdentity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// generateOIDCLogin returns a new login with random state, nonce and code verifier.
+func generateOIDCLogin(ttl time.Duration) (*OIDCLogin, error) {
+	login := &OIDCLogin{Expiry: time.Now().Add(ttl)}
+
+	for _, s := range []*string{&login.State, &login.Nonce, &login.CodeVerifier} {
+		// PKCE code verifiers must be at least 43 characters long, which 32 random
+		// bytes encode to.
+		randomBytes := make([]byte, 32)
+		_, err := rand.Read(randomBytes)
+		if err != nil {
+			return nil, err
+		}
+		*s = base64.RawURLEncoding.EncodeToString(randomBytes)
+	}
+
+	hash := sha256.Sum256([]byte(login.State))
+	login.Hash = hash[:]
+
+	return login, nil
+}
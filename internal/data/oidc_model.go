@@ -0,0 +1,158 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// OIDCModel is a struct that wraps a sql.DB connection pool and provides methods for
+// interacting with the logins and identities of the external OpenID Connect provider.
+type OIDCModel struct {
+	DB *sql.DB
+}
+
+// NewLogin starts a new login with the provider, valid for the given duration.
+func (m OIDCModel) NewLogin(ttl time.Duration) (*OIDCLogin, error) {
+	login, err := generateOIDCLogin(ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO oidc_logins (hash, nonce, code_verifier, expiry)
+		VALUES ($1, $2, $3, $4)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, login.Hash, login.Nonce, login.CodeVerifier, login.Expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return login, nil
+}
+
+// ConsumeLogin returns the login with the given state and deletes it, so that it can
+// only be completed once. It returns ErrRecordNotFound if the login doesn't exist or
+// has expired.
+func (m OIDCModel) ConsumeLogin(state string) (*OIDCLogin, error) {
+	hash := sha256.Sum256([]byte(state))
+
+	query := `
+		DELETE FROM oidc_logins
+		WHERE hash = $1
+		RETURNING nonce, code_verifier, expiry`
+
+	login := OIDCLogin{State: state, Hash: hash[:]}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:]).Scan(&login.Nonce, &login.CodeVerifier, &login.Expiry)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if time.Now().After(login.Expiry) {
+		return nil, ErrRecordNotFound
+	}
+
+	return &login, nil
+}
+
+// GetUserForIdentity returns the user linked to the account with the given issuer and
+// subject.
+func (m OIDCModel) GetUserForIdentity(issuer, subject string) (*User, error) {
+	query := `
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.deactivated, users.version
+		FROM users
+		INNER JOIN user_identities ON users.id = user_identities.user_id
+		WHERE user_identities.issuer = $1 AND user_identities.subject = $2`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, issuer, subject).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Deactivated,
+		&user.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// LinkIdentity links the account with the given issuer and subject to the user. It
+// does nothing if the account is already linked.
+func (m OIDCModel) LinkIdentity(issuer, subject string, userID int64) error {
+	query := `
+		INSERT INTO user_identities (issuer, subject, user_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (issuer, subject) DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, issuer, subject, userID)
+	return err
+}
+
+// GetIdentitiesForUser returns the accounts linked to the user.
+func (m OIDCModel) GetIdentitiesForUser(userID int64) ([]*UserIdentity, error) {
+	query := `
+		SELECT issuer, subject, created_at
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*UserIdentity{}
+
+	for rows.Next() {
+		var identity UserIdentity
+
+		err := rows.Scan(&identity.Issuer, &identity.Subject, &identity.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		identities = append(identities, &identity)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
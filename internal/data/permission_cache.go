@@ -0,0 +1,143 @@
+package data
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// PermissionChangesChannel is the Postgres notification channel on which the ID of
+// every user whose permissions changed is published, or an empty payload when the
+// permissions of a role changed.
+const PermissionChangesChannel = "permission_changes"
+
+// PermissionCache is a bounded, in-process cache of the effective permissions of users
+// keyed by user ID. As for the MovieCache, the least recently used entry is evicted
+// when the cache is full, and entries expire after the TTL so that a missed
+// invalidation only grants stale permissions for a bounded time.
+type PermissionCache struct {
+	mu       sync.Mutex
+	size     int
+	ttl      time.Duration
+	order    *list.List
+	entries  map[int64]*list.Element
+	stats    PermissionCacheStats
+	modified uint64
+}
+
+// PermissionCacheStats holds the counters describing the cache efficiency.
+type PermissionCacheStats struct {
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`
+	Expired       uint64 `json:"expired"`
+	Invalidations uint64 `json:"invalidations"`
+	Entries       int    `json:"entries"`
+}
+
+type permissionCacheEntry struct {
+	userID      int64
+	permissions Permissions
+	expires     time.Time
+}
+
+// NewPermissionCache returns a cache holding the permissions of up to size users for
+// the given TTL.
+func NewPermissionCache(size int, ttl time.Duration) *PermissionCache {
+	return &PermissionCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[int64]*list.Element),
+	}
+}
+
+// get returns a copy of the cached permissions of the user, if there are any. On a
+// miss, it also returns the modification counter of the cache, to pass to add.
+func (c *PermissionCache) get(userID int64) (Permissions, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[userID]
+	if ok && time.Now().After(elem.Value.(*permissionCacheEntry).expires) {
+		c.remove(elem)
+		c.stats.Expired++
+		ok = false
+	}
+
+	if !ok {
+		c.stats.Misses++
+		return nil, c.modified, false
+	}
+
+	c.stats.Hits++
+	c.order.MoveToFront(elem)
+	return append(Permissions{}, elem.Value.(*permissionCacheEntry).permissions...), 0, true
+}
+
+// add stores a copy of the permissions of the user read from the database, unless the
+// cache has been invalidated since they were looked up in it, in which case they may
+// be stale already.
+func (c *PermissionCache) add(userID int64, permissions Permissions, modified uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.modified != modified {
+		return
+	}
+
+	if elem, ok := c.entries[userID]; ok {
+		c.remove(elem)
+	}
+
+	entry := &permissionCacheEntry{
+		userID:      userID,
+		permissions: append(Permissions{}, permissions...),
+		expires:     time.Now().Add(c.ttl),
+	}
+	c.entries[userID] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+// Invalidate removes the permissions of the user from the cache.
+func (c *PermissionCache) Invalidate(userID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.modified++
+	c.stats.Invalidations++
+	if elem, ok := c.entries[userID]; ok {
+		c.remove(elem)
+	}
+}
+
+// Purge removes the permissions of every user from the cache. It is used when the
+// permissions of a role change, and when invalidations may have been missed.
+func (c *PermissionCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.modified++
+	c.stats.Invalidations++
+	c.order.Init()
+	c.entries = make(map[int64]*list.Element)
+}
+
+// Stats returns the current counters of the cache.
+func (c *PermissionCache) Stats() PermissionCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	return stats
+}
+
+func (c *PermissionCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*permissionCacheEntry).userID)
+}
@@ -11,17 +11,36 @@ import (
 // to interact with the permission tables in the database.
 type PermissionModel struct {
 	DB *sql.DB
+	// Cache holds the permissions read by GetAllForUser, if it is set. Users are
+	// invalidated when their permissions change, and the other API instances
+	// invalidate their own cache when notified of the change.
+	Cache *PermissionCache
 }
 
-// GetAllForUser returns all permission codes for a specific user in
-// a Permission slice.
+// GetAllForUser returns the effective permission codes of a specific user, granted
+// either directly or through their roles, in alphabetical order.
 func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	var modified uint64
+	if m.Cache != nil {
+		permissions, counter, ok := m.Cache.get(userID)
+		if ok {
+			return permissions, nil
+		}
+		modified = counter
+	}
+
 	query := `
 		SELECT permissions.code
 		FROM permissions
 		INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-		INNER JOIN users ON users_permissions.user_id = users.id
-		WHERE users.id = $1`
+		WHERE users_permissions.user_id = $1
+		UNION
+		SELECT permissions.code
+		FROM permissions
+		INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+		INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+		WHERE users_roles.user_id = $1
+		ORDER BY code`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -33,7 +52,7 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 
 	defer rows.Close()
 
-	var permissions Permissions
+	permissions := Permissions{}
 	for rows.Next() {
 		var permission string
 		err := rows.Scan(&permission)
@@ -47,18 +66,96 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 		return nil, err
 	}
 
+	if m.Cache != nil {
+		m.Cache.add(userID, permissions, modified)
+	}
+
 	return permissions, nil
 }
 
-// AddForUser adds the given permissions to the user.
+// AddForUser adds the given permissions to the user, ignoring the ones they already
+// have.
 func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
 	query := `
 		INSERT INTO users_permissions
-		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+		ON CONFLICT DO NOTHING`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	if m.Cache != nil {
+		defer m.Cache.Invalidate(userID)
+	}
+
 	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
 	return err
 }
+
+// RemoveForUser removes the given permissions granted directly to the user. It returns
+// ErrRecordNotFound if the user had none of them.
+func (m PermissionModel) RemoveForUser(userID int64, codes ...string) error {
+	query := `
+		DELETE FROM users_permissions
+		USING permissions
+		WHERE users_permissions.permission_id = permissions.id
+		AND users_permissions.user_id = $1
+		AND permissions.code = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if m.Cache != nil {
+		defer m.Cache.Invalidate(userID)
+	}
+
+	result, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAll returns every permission code, in alphabetical order.
+func (m PermissionModel) GetAll() (Permissions, error) {
+	query := `
+		SELECT code
+		FROM permissions
+		ORDER BY code`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	permissions := Permissions{}
+	for rows.Next() {
+		var permission string
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
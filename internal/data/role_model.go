@@ -0,0 +1,337 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+// ErrDuplicateRoleName is a custom error that represent two roles with the same name.
+var ErrDuplicateRoleName = errors.New("duplicate role name")
+
+// RoleModel wraps a sql.DB connection pool and provides methods to interact with the
+// roles tables in the database.
+type RoleModel struct {
+	DB *sql.DB
+	// PermissionCache is the cache of the PermissionModel, if it is set, which is
+	// invalidated when the roles of users or the permissions of roles change.
+	PermissionCache *PermissionCache
+}
+
+// roleQuery selects the roles along with their permissions, in alphabetical order.
+// The WHERE clause is appended to it.
+const roleQuery = `
+		SELECT roles.id, roles.created_at, roles.name, roles.description, roles.version,
+			COALESCE(array_agg(permissions.code ORDER BY permissions.code) FILTER (WHERE permissions.code IS NOT NULL), '{}')
+		FROM roles
+		LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+		LEFT JOIN permissions ON permissions.id = roles_permissions.permission_id`
+
+// Insert adds a new role along with its permissions.
+func (m RoleModel) Insert(role *Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO roles (name, description)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version`
+
+	err = tx.QueryRowContext(ctx, query, role.Name, role.Description).Scan(&role.ID, &role.CreatedAt, &role.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "roles_name_key"`:
+			return ErrDuplicateRoleName
+		default:
+			return err
+		}
+	}
+
+	err = setRolePermissions(ctx, tx, role)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Get returns the role with the given ID.
+func (m RoleModel) Get(id int64) (*Role, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	return m.getOne(roleQuery+`
+		WHERE roles.id = $1
+		GROUP BY roles.id`, id)
+}
+
+// GetByName returns the role with the given name.
+func (m RoleModel) GetByName(name string) (*Role, error) {
+	return m.getOne(roleQuery+`
+		WHERE roles.name = $1
+		GROUP BY roles.id`, name)
+}
+
+func (m RoleModel) getOne(query string, arg any) (*Role, error) {
+	var role Role
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, arg).Scan(
+		&role.ID,
+		&role.CreatedAt,
+		&role.Name,
+		&role.Description,
+		&role.Version,
+		pq.Array(&role.Permissions),
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &role, nil
+}
+
+// GetAll returns every role, in alphabetical order.
+func (m RoleModel) GetAll() ([]*Role, error) {
+	query := roleQuery + `
+		GROUP BY roles.id
+		ORDER BY roles.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	roles := []*Role{}
+
+	for rows.Next() {
+		var role Role
+
+		err := rows.Scan(
+			&role.ID,
+			&role.CreatedAt,
+			&role.Name,
+			&role.Description,
+			&role.Version,
+			pq.Array(&role.Permissions),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, &role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// Update saves the details of the role, replacing its permissions.
+func (m RoleModel) Update(role *Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE roles
+		SET name = $1, description = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+
+	args := []any{role.Name, role.Description, role.ID, role.Version}
+
+	if m.PermissionCache != nil {
+		defer m.PermissionCache.Purge()
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&role.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "roles_name_key"`:
+			return ErrDuplicateRoleName
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `
+		DELETE FROM roles_permissions
+		WHERE role_id = $1`
+
+	_, err = tx.ExecContext(ctx, query, role.ID)
+	if err != nil {
+		return err
+	}
+
+	err = setRolePermissions(ctx, tx, role)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setRolePermissions grants the permissions of the role to it.
+func setRolePermissions(ctx context.Context, tx *sql.Tx, role *Role) error {
+	query := `
+		INSERT INTO roles_permissions
+		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+
+	_, err := tx.ExecContext(ctx, query, role.ID, pq.Array(role.Permissions))
+	return err
+}
+
+// Delete deletes the role, taking it away from the users who had it.
+func (m RoleModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM roles
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if m.PermissionCache != nil {
+		defer m.PermissionCache.Purge()
+	}
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllForUser returns the names of the roles of a specific user, in alphabetical
+// order.
+func (m RoleModel) GetAllForUser(userID int64) ([]string, error) {
+	query := `
+		SELECT roles.name
+		FROM roles
+		INNER JOIN users_roles ON users_roles.role_id = roles.id
+		WHERE users_roles.user_id = $1
+		ORDER BY roles.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// AddForUser gives the named roles to the user, ignoring the ones they already have.
+func (m RoleModel) AddForUser(userID int64, names ...string) error {
+	query := `
+		INSERT INTO users_roles
+		SELECT $1, roles.id FROM roles WHERE roles.name = ANY($2)
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if m.PermissionCache != nil {
+		defer m.PermissionCache.Invalidate(userID)
+	}
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(names))
+	return err
+}
+
+// RemoveForUser takes the named role away from the user. It returns
+// ErrRecordNotFound if the user didn't have it.
+func (m RoleModel) RemoveForUser(userID int64, name string) error {
+	query := `
+		DELETE FROM users_roles
+		USING roles
+		WHERE users_roles.role_id = roles.id
+		AND users_roles.user_id = $1
+		AND roles.name = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if m.PermissionCache != nil {
+		defer m.PermissionCache.Invalidate(userID)
+	}
+
+	result, err := m.DB.ExecContext(ctx, query, userID, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
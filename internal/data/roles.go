@@ -0,0 +1,41 @@
+package data
+
+import (
+	"github.com/hayohtee/greenlight/internal/validator"
+	"regexp"
+	"time"
+)
+
+// RoleNameRX is a regular expression for role names, such as "viewer".
+var RoleNameRX = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// Role is a type that represent a named bundle of permissions granted to users.
+type Role struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Permissions Permissions `json:"permissions"`
+	Version     int32       `json:"version"`
+}
+
+// ValidateRoleName adds validation check on the name of a role.
+func ValidateRoleName(v *validator.Validator, name string) {
+	v.Check(name != "", "name", "must be provided")
+	v.Check(len(name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(validator.Matches(name, RoleNameRX), "name", "must only contain lowercase letters, digits, hyphens and underscores, starting with a letter")
+}
+
+// ValidateRole adds validation check on the role, whose permissions must be among the
+// known ones.
+func ValidateRole(v *validator.Validator, role *Role, known Permissions) {
+	ValidateRoleName(v, role.Name)
+
+	v.Check(len(role.Description) <= 2000, "description", "must not be more than 2000 bytes long")
+
+	v.Check(role.Permissions != nil, "permissions", "must be provided")
+	v.Check(validator.Unique(role.Permissions), "permissions", "must not contain duplicate values")
+	for _, code := range role.Permissions {
+		v.Check(known.Include(code), "permissions", "must only contain existing permissions")
+	}
+}
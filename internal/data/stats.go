@@ -0,0 +1,175 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// MovieStats is a type that holds aggregated statistics about the movie catalog.
+type MovieStats struct {
+	TotalMovies        int                `json:"total_movies"`
+	Genres             []GenreCount       `json:"genres"`
+	Years              []YearCount        `json:"years"`
+	RuntimePercentiles RuntimePercentiles `json:"runtime_percentiles"`
+	AddedPerWeek       []WeekCount        `json:"added_per_week"`
+	RefreshedAt        time.Time          `json:"refreshed_at"`
+}
+
+// GenreCount holds the number of movies for a specific genre.
+type GenreCount struct {
+	Genre string `json:"genre"`
+	Total int    `json:"total"`
+}
+
+// YearCount holds the number of movies released in a specific year.
+type YearCount struct {
+	Year  int32 `json:"year"`
+	Total int   `json:"total"`
+}
+
+// WeekCount holds the number of movies added during the week starting on Week.
+type WeekCount struct {
+	Week  time.Time `json:"week"`
+	Total int       `json:"total"`
+}
+
+// RuntimePercentiles holds the distribution of movie runtimes.
+type RuntimePercentiles struct {
+	P25 Runtime `json:"p25"`
+	P50 Runtime `json:"p50"`
+	P75 Runtime `json:"p75"`
+	P90 Runtime `json:"p90"`
+	P99 Runtime `json:"p99"`
+}
+
+// StatsModel is a struct which wraps a sql.DB connection pool and provides
+// methods for reading the catalog statistics materialized views.
+type StatsModel struct {
+	DB *sql.DB
+}
+
+// GetMovieStats returns the catalog statistics as of the last refresh, including
+// the movies added per week for the given number of most recent weeks.
+func (m StatsModel) GetMovieStats(weeks int) (*MovieStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stats := MovieStats{
+		Genres:       []GenreCount{},
+		Years:        []YearCount{},
+		AddedPerWeek: []WeekCount{},
+	}
+
+	query := `
+		SELECT total_movies, runtime_p25, runtime_p50, runtime_p75, runtime_p90, runtime_p99, refreshed_at
+		FROM movie_stats_summary`
+
+	err := m.DB.QueryRowContext(ctx, query).Scan(
+		&stats.TotalMovies,
+		&stats.RuntimePercentiles.P25,
+		&stats.RuntimePercentiles.P50,
+		&stats.RuntimePercentiles.P75,
+		&stats.RuntimePercentiles.P90,
+		&stats.RuntimePercentiles.P99,
+		&stats.RefreshedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT genre, total
+		FROM movie_stats_genres
+		ORDER BY total DESC, genre ASC`
+
+	err = m.scan(ctx, query, nil, func(rows *sql.Rows) error {
+		var genre GenreCount
+		if err := rows.Scan(&genre.Genre, &genre.Total); err != nil {
+			return err
+		}
+		stats.Genres = append(stats.Genres, genre)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT year, total
+		FROM movie_stats_years
+		ORDER BY year DESC`
+
+	err = m.scan(ctx, query, nil, func(rows *sql.Rows) error {
+		var year YearCount
+		if err := rows.Scan(&year.Year, &year.Total); err != nil {
+			return err
+		}
+		stats.Years = append(stats.Years, year)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT week, total
+		FROM movie_stats_weekly
+		WHERE week > date_trunc('week', $1::timestamptz) - make_interval(weeks => $2)
+		ORDER BY week DESC`
+
+	err = m.scan(ctx, query, []any{stats.RefreshedAt, weeks}, func(rows *sql.Rows) error {
+		var week WeekCount
+		if err := rows.Scan(&week.Week, &week.Total); err != nil {
+			return err
+		}
+		stats.AddedPerWeek = append(stats.AddedPerWeek, week)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// scan runs the query and calls fn for each of the resulting rows.
+func (m StatsModel) scan(ctx context.Context, query string, args []any, fn func(*sql.Rows) error) error {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Refresh recomputes all the catalog statistics materialized views. The views
+// are refreshed concurrently so that reads are not blocked in the meantime.
+func (m StatsModel) Refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	views := []string{"movie_stats_summary", "movie_stats_genres", "movie_stats_years", "movie_stats_weekly"}
+	for _, view := range views {
+		_, err = tx.ExecContext(ctx, "REFRESH MATERIALIZED VIEW CONCURRENTLY "+view)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
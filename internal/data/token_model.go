@@ -2,8 +2,11 @@ package data
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"errors"
 	"github.com/hayohtee/greenlight/internal/validator"
+	"github.com/lib/pq"
 	"time"
 )
 
@@ -14,6 +17,10 @@ func ValidateTokenPlainText(v *validator.Validator, tokenPlainText string) {
 	v.Check(len(tokenPlainText) == 26, "token", "must be 26 bytes long")
 }
 
+// ErrTokenReused is returned when a refresh token which has already been rotated is
+// used again.
+var ErrTokenReused = errors.New("token reused")
+
 // TokenModel is a struct that wraps a sql.DB connection and methods for
 // interacting with tokens table in the database.
 type TokenModel struct {
@@ -30,13 +37,265 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
+// NewSession creates a new authentication token and refresh token pair issued to the
+// client with the given IP address and user agent, starting a new token family. Both
+// tokens are inserted into the tokens table and returned.
+func (m TokenModel) NewSession(userID int64, authenticationTTL, refreshTTL time.Duration, ip, userAgent string) (*Token, *Token, error) {
+	family, err := randomString()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	grant := tokenGrant{userID: userID, family: family}
+
+	authenticationToken, refreshToken, err := insertTokenPair(ctx, tx, grant, authenticationTTL, refreshTTL, ip, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return authenticationToken, refreshToken, nil
+}
+
+// NewOAuthSession is like NewSession, for the tokens issued to an OAuth client on
+// behalf of the user, restricted to the given scopes.
+func (m TokenModel) NewOAuthSession(userID, clientID int64, scopes []string, authenticationTTL, refreshTTL time.Duration, ip, userAgent string) (*Token, *Token, error) {
+	family, err := randomString()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	grant := tokenGrant{userID: userID, family: family, clientID: clientID, scopes: scopes}
+
+	authenticationToken, refreshToken, err := insertTokenPair(ctx, tx, grant, authenticationTTL, refreshTTL, ip, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return authenticationToken, refreshToken, nil
+}
+
+// NewOAuthToken creates a new authentication token issued to an OAuth client on behalf
+// of the user, restricted to the given scopes, without a refresh token.
+func (m TokenModel) NewOAuthToken(userID, clientID int64, scopes []string, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(userID, ttl, ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+	token.ClientID = clientID
+	token.Scopes = scopes
+
+	query := `
+		INSERT INTO tokens(hash, user_id, expiry, scope, client_id, scopes)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.ClientID, pq.Array(token.Scopes)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	return token, err
+}
+
+// Rotate exchanges a refresh token for a new authentication token and refresh token
+// pair in the same family, revoking the family's previous authentication token. The
+// used refresh token is kept, marked as rotated, until it expires. If it is presented
+// again, it has most likely been stolen, so the whole family is revoked and
+// ErrTokenReused is returned, along with a rotation holding the owner of the family
+// only. The refresh token must have been issued to the OAuth client with the given ID,
+// or to a first-party client if it is zero, and the new tokens keep its scopes.
+func (m TokenModel) Rotate(refreshPlainText string, clientID int64, authenticationTTL, refreshTTL time.Duration, ip, userAgent string) (*TokenRotation, error) {
+	tokenHash := sha256.Sum256([]byte(refreshPlainText))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT user_id, family, scopes, rotated_at IS NOT NULL
+		FROM tokens
+		WHERE hash = $1 AND scope = $2 AND expiry > $3 AND COALESCE(client_id, 0) = $4
+		FOR UPDATE`
+
+	grant := tokenGrant{clientID: clientID}
+	var rotated bool
+
+	err = tx.QueryRowContext(ctx, query, tokenHash[:], ScopeRefresh, time.Now(), clientID).Scan(
+		&grant.userID,
+		&grant.family,
+		pq.Array(&grant.scopes),
+		&rotated,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	rotation := &TokenRotation{UserID: grant.userID}
+
+	if rotated {
+		query = `
+			DELETE FROM tokens
+			WHERE family = $1`
+
+		_, err = tx.ExecContext(ctx, query, grant.family)
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+
+		return rotation, ErrTokenReused
+	}
+
+	query = `
+		UPDATE tokens
+		SET rotated_at = NOW()
+		WHERE hash = $1`
+
+	_, err = tx.ExecContext(ctx, query, tokenHash[:])
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		DELETE FROM tokens
+		WHERE family = $1 AND scope = $2
+		RETURNING id`
+
+	rows, err := tx.QueryContext(ctx, query, grant.family, ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rotation.RevokedIDs = append(rotation.RevokedIDs, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+
+	rotation.AuthenticationToken, rotation.RefreshToken, err = insertTokenPair(ctx, tx, grant, authenticationTTL, refreshTTL, ip, userAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return rotation, nil
+}
+
+// tokenGrant holds what the tokens of a family are issued for.
+type tokenGrant struct {
+	userID   int64
+	family   string
+	clientID int64
+	scopes   []string
+}
+
+// insertTokenPair generates and inserts an authentication token and a refresh token of
+// the grant within the transaction.
+func insertTokenPair(ctx context.Context, tx *sql.Tx, grant tokenGrant, authenticationTTL, refreshTTL time.Duration, ip, userAgent string) (*Token, *Token, error) {
+	// Truncate the user agent, which is set by the client.
+	if len(userAgent) > 500 {
+		userAgent = userAgent[:500]
+	}
+
+	query := `
+		INSERT INTO tokens(hash, user_id, expiry, scope, ip, user_agent, family, client_id, scopes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), $9)
+		RETURNING id`
+
+	var tokens []*Token
+	for _, t := range []struct {
+		scope string
+		ttl   time.Duration
+	}{
+		{ScopeAuthentication, authenticationTTL},
+		{ScopeRefresh, refreshTTL},
+	} {
+		token, err := generateToken(grant.userID, t.ttl, t.scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		token.IP = ip
+		token.UserAgent = userAgent
+		token.Family = grant.family
+		token.ClientID = grant.clientID
+		token.Scopes = grant.scopes
+
+		args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.IP, token.UserAgent, token.Family, token.ClientID, pq.Array(token.Scopes)}
+
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&token.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens[0], tokens[1], nil
+}
+
 // Insert adds the data for a specific token to the tokens table.
 func (m TokenModel) Insert(token *Token) error {
 	query := `
-		INSERT INTO tokens(hash, user_id, expiry, scope)
-		VALUES ($1, $2, $3, $4)`
+		INSERT INTO tokens(hash, user_id, expiry, scope, ip, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6)`
 
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.IP, token.UserAgent}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -57,3 +316,299 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+// RecordFailedAttempt counts an invalid attempt to use the token with the given scope
+// and plaintext, returning the number of invalid attempts made with it so far.
+func (m TokenModel) RecordFailedAttempt(scope, plainText string) (int, error) {
+	hash := sha256.Sum256([]byte(plainText))
+
+	query := `
+		UPDATE tokens
+		SET failed_attempts = failed_attempts + 1
+		WHERE hash = $1 AND scope = $2
+		RETURNING failed_attempts`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var attempts int
+	err := m.DB.QueryRowContext(ctx, query, hash[:], scope).Scan(&attempts)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return attempts, nil
+}
+
+// RecordFailedSessionAttempt counts an invalid attempt made with the session of the
+// user with the given ID, returning the number of invalid attempts made with it so far.
+func (m TokenModel) RecordFailedSessionAttempt(userID, sessionID int64) (int, error) {
+	query := `
+		UPDATE tokens
+		SET failed_attempts = failed_attempts + 1
+		WHERE id = $1 AND user_id = $2 AND scope = $3
+		RETURNING failed_attempts`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var attempts int
+	err := m.DB.QueryRowContext(ctx, query, sessionID, userID, ScopeAuthentication).Scan(&attempts)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return attempts, nil
+}
+
+// LatestExpiry returns the expiry time of the most recent token for a specific user
+// and scope, or the zero time if there is none. As tokens of the same scope share
+// the same time to live, it tells when the latest token was issued.
+func (m TokenModel) LatestExpiry(scope string, userID int64) (time.Time, error) {
+	query := `
+		SELECT MAX(expiry)
+		FROM tokens
+		WHERE scope = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var expiry sql.NullTime
+	err := m.DB.QueryRowContext(ctx, query, scope, userID).Scan(&expiry)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return expiry.Time, nil
+}
+
+// GetSessionsForUser returns the unexpired authentication tokens of a specific user,
+// most recently used first.
+func (m TokenModel) GetSessionsForUser(userID int64) ([]*Session, error) {
+	query := `
+		SELECT id, created_at, last_used_at, expiry, ip, user_agent, COALESCE(client_id, 0), scopes
+		FROM tokens
+		WHERE scope = $1 AND user_id = $2 AND expiry > $3
+		ORDER BY COALESCE(last_used_at, created_at) DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, ScopeAuthentication, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+
+		err := rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+			&session.IP,
+			&session.UserAgent,
+			&session.ClientID,
+			pq.Array(&session.Scopes),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// TouchSession records that the authentication token with the given ID was just used.
+func (m TokenModel) TouchSession(id int64) error {
+	query := `
+		UPDATE tokens
+		SET last_used_at = NOW()
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// DeleteSession deletes the authentication token with the given ID, if it belongs to
+// the given user, along with the other tokens of its family so that the session can't
+// be refreshed.
+func (m TokenModel) DeleteSession(userID, id int64) error {
+	query := `
+		WITH session AS (
+			SELECT id, family
+			FROM tokens
+			WHERE id = $1 AND user_id = $2 AND scope = $3
+		)
+		DELETE FROM tokens
+		WHERE user_id = $2
+		AND (id IN (SELECT id FROM session) OR family IN (SELECT family FROM session WHERE family <> ''))`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID, ScopeAuthentication)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Revoke records that the signed token with the given ID is revoked until it expires.
+// Revocations of tokens which have already expired are deleted at the same time.
+func (m TokenModel) Revoke(jti string, expiry time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO revoked_tokens(jti, expiry)
+		VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING`
+
+	_, err := m.DB.ExecContext(ctx, query, jti, expiry)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		DELETE FROM revoked_tokens
+		WHERE expiry <= $1`
+
+	_, err = m.DB.ExecContext(ctx, query, time.Now())
+	return err
+}
+
+// GetRevoked returns the expiry time of the revoked signed tokens which haven't
+// expired yet, by token ID.
+func (m TokenModel) GetRevoked() (map[string]time.Time, error) {
+	query := `
+		SELECT jti, expiry
+		FROM revoked_tokens
+		WHERE expiry > $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	revoked := make(map[string]time.Time)
+	for rows.Next() {
+		var jti string
+		var expiry time.Time
+
+		err := rows.Scan(&jti, &expiry)
+		if err != nil {
+			return nil, err
+		}
+
+		revoked[jti] = expiry
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revoked, nil
+}
+
+// RevokeUser records that the signed tokens of the user issued up to the revocation
+// time are revoked. Revocations which have expired are deleted at the same time.
+func (m TokenModel) RevokeUser(userID int64, revocation UserRevocation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO revoked_users_tokens(user_id, revoked_before, expiry)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET revoked_before = GREATEST(revoked_users_tokens.revoked_before, EXCLUDED.revoked_before),
+		    expiry = GREATEST(revoked_users_tokens.expiry, EXCLUDED.expiry)`
+
+	_, err := m.DB.ExecContext(ctx, query, userID, revocation.Before, revocation.Expiry)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		DELETE FROM revoked_users_tokens
+		WHERE expiry <= $1`
+
+	_, err = m.DB.ExecContext(ctx, query, time.Now())
+	return err
+}
+
+// GetRevokedUsers returns the revocations of the signed tokens of users which haven't
+// expired yet, by user ID.
+func (m TokenModel) GetRevokedUsers() (map[int64]UserRevocation, error) {
+	query := `
+		SELECT user_id, revoked_before, expiry
+		FROM revoked_users_tokens
+		WHERE expiry > $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	revoked := make(map[int64]UserRevocation)
+	for rows.Next() {
+		var userID int64
+		var revocation UserRevocation
+
+		err := rows.Scan(&userID, &revocation.Before, &revocation.Expiry)
+		if err != nil {
+			return nil, err
+		}
+
+		revoked[userID] = revocation
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revoked, nil
+}
@@ -13,17 +13,80 @@ const (
 	ScopeActivation = "activation"
 	// ScopeAuthentication represents authentication scope.
 	ScopeAuthentication = "authentication"
+	// ScopePasswordReset represents password reset scope.
+	ScopePasswordReset = "password-reset"
+	// ScopeRefresh represents refresh scope.
+	ScopeRefresh = "refresh"
+	// ScopeTwoFactor represents the scope of the challenge issued after a valid
+	// password, for a user with two-factor authentication enabled.
+	ScopeTwoFactor = "two-factor"
+	// ScopeEmailChange represents the scope of the confirmation sent to the new email
+	// address of a user.
+	ScopeEmailChange = "email-change"
 )
 
+// TokenRevocationsChannel is the Postgres notification channel on which a notification
+// is published whenever signed tokens are revoked.
+const TokenRevocationsChannel = "token_revocations"
+
+// UserRevocation records that the signed tokens of a user issued up to Before are
+// revoked, until the last of them expires at Expiry.
+type UserRevocation struct {
+	Before time.Time
+	Expiry time.Time
+}
+
 // Token is a struct to hold the data for an individual token. This
 // includes the plainText and hashed version of the token, associated
 // user ID, expiry time and scope.
 type Token struct {
+	ID        int64     `json:"-"`
 	PlainText string    `json:"token"`
 	Hash      []byte    `json:"-"`
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	// IP and UserAgent identify the client an authentication token was issued to.
+	IP        string `json:"-"`
+	UserAgent string `json:"-"`
+	// Family is shared by the authentication and refresh tokens issued from the same
+	// login, including the ones issued by rotating a refresh token.
+	Family string `json:"-"`
+	// ClientID and Scopes are set for the tokens issued to an OAuth client, which are
+	// restricted to the permission codes in Scopes.
+	ClientID int64    `json:"-"`
+	Scopes   []string `json:"-"`
+}
+
+// TokenRotation is the result of the rotation of a refresh token. RevokedIDs holds the
+// IDs of the authentication tokens of the family which the rotation deleted, so that
+// the signed tokens issued for them can be revoked as well.
+type TokenRotation struct {
+	UserID              int64
+	AuthenticationToken *Token
+	RefreshToken        *Token
+	RevokedIDs          []int64
+}
+
+// Session is a type that represent an active authentication token, as shown to the
+// user it was issued to. Current is set for the token used by the request.
+type Session struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	Expiry     time.Time  `json:"expiry"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	Current    bool       `json:"current"`
+	// ClientID and Scopes are set for the sessions of OAuth clients, see Token.
+	ClientID int64    `json:"oauth_client_id,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+}
+
+// NeedsTouch reports whether the last used time of the session is stale enough to be
+// updated, which is only done once a minute to avoid a write on every request.
+func (s *Session) NeedsTouch() bool {
+	return s.LastUsedAt == nil || time.Since(*s.LastUsedAt) > time.Minute
 }
 
 // generateToken returns new token instance containing the given user ID, duration
@@ -35,6 +98,23 @@ func generateToken(userId int64, ttl time.Duration, scope string) (*Token, error
 		Scope:  scope,
 	}
 
+	plainText, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	token.PlainText = plainText
+
+	// Generate an SHA-256 hash of the plainText token string.
+	// Note that sha256.Sum256() function returns array of length 32, so to make it
+	// easier to work with we convert it to a slice using the [:] before storing it.
+	hash := sha256.Sum256([]byte(token.PlainText))
+	token.Hash = hash[:]
+
+	return token, nil
+}
+
+// randomString returns a new unguessable string built from 16 random bytes.
+func randomString() (string, error) {
 	// Initialize a zero-valued byte slice with a length of 16 bytes.
 	randomBytes := make([]byte, 16)
 
@@ -42,23 +122,15 @@ func generateToken(userId int64, ttl time.Duration, scope string) (*Token, error
 	// slice with random bytes from the operating system's CSPRING.
 	_, err := rand.Read(randomBytes)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	// Encode the byte slice to a base-32-encoded string and assign it to the token
-	// PlainText field. This will look similar to this:
+	// Encode the byte slice to a base-32-encoded string. This will look similar
+	// to this:
 	//
 	// Y3QMGX3PJ3WLRL2YRTQGQ6KRHU
 	//
 	// The default base-32 strings may be padded at the end with the = character. So
 	// we use WithPadding(base32.NoPadding) method to omit them.
-	token.PlainText = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
-
-	// Generate an SHA-256 hash of the plainText token string.
-	// Note that sha256.Sum256() function returns array of length 32, so to make it
-	// easier to work with we convert it to a slice using the [:] before storing it.
-	hash := sha256.Sum256([]byte(token.PlainText))
-	token.Hash = hash[:]
-
-	return token, nil
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
 }
@@ -0,0 +1,72 @@
+package data
+
+import (
+	"crypto/sha256"
+	"github.com/hayohtee/greenlight/internal/validator"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TwoFactor is a type that holds the TOTP enrolment of a user. Secret is encrypted,
+// and ConfirmedAt is nil until the user proves they have set up their authenticator.
+type TwoFactor struct {
+	UserID       int64
+	CreatedAt    time.Time
+	Secret       []byte
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+}
+
+// Enabled reports whether the enrolment has been confirmed.
+func (t *TwoFactor) Enabled() bool {
+	return t.ConfirmedAt != nil
+}
+
+// recoveryCodeCount is the number of recovery codes generated for a user.
+const recoveryCodeCount = 10
+
+var (
+	// TOTPCodeRX is a regular expression for the codes of authenticator apps.
+	TOTPCodeRX = regexp.MustCompile(`^[0-9]{6}$`)
+	// RecoveryCodeRX is a regular expression for normalized recovery codes.
+	RecoveryCodeRX = regexp.MustCompile(`^[A-Z2-7]{10}$`)
+)
+
+// NormalizeRecoveryCode removes the separators and case differences users may type in
+// a recovery code.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// generateRecoveryCodes returns new recovery codes formatted for display, along with
+// their hashes.
+func generateRecoveryCodes() ([]string, [][]byte, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([][]byte, recoveryCodeCount)
+
+	for i := range codes {
+		s, err := randomString()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		codes[i] = s[:5] + "-" + s[5:10]
+		hash := sha256.Sum256([]byte(s[:10]))
+		hashes[i] = hash[:]
+	}
+
+	return codes, hashes, nil
+}
+
+// ValidateTwoFactorCode checks that the code is either a code from an authenticator
+// app or a recovery code.
+func ValidateTwoFactorCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(
+		validator.Matches(code, TOTPCodeRX) || validator.Matches(NormalizeRecoveryCode(code), RecoveryCodeRX),
+		"code",
+		"must be a 6 digits code or a recovery code",
+	)
+}
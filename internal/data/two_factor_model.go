@@ -0,0 +1,227 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrTwoFactorEnabled is returned when starting an enrolment for a user who has
+// already enabled two-factor authentication.
+var ErrTwoFactorEnabled = errors.New("two-factor authentication already enabled")
+
+// TwoFactorModel is a struct that wraps a sql.DB connection pool and provides methods
+// for interacting with the two-factor authentication tables in the database.
+type TwoFactorModel struct {
+	DB *sql.DB
+}
+
+// Enrol starts a new enrolment for the user with the encrypted secret, replacing any
+// pending one. It returns ErrTwoFactorEnabled if the user has a confirmed enrolment.
+func (m TwoFactorModel) Enrol(userID int64, secret []byte) error {
+	query := `
+		INSERT INTO users_two_factor (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, created_at = NOW(), last_used_step = 0
+		WHERE users_two_factor.confirmed_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrTwoFactorEnabled
+	}
+
+	return nil
+}
+
+// Get returns the enrolment of the user, confirmed or not.
+func (m TwoFactorModel) Get(userID int64) (*TwoFactor, error) {
+	query := `
+		SELECT user_id, created_at, secret, confirmed_at, last_used_step
+		FROM users_two_factor
+		WHERE user_id = $1`
+
+	var twoFactor TwoFactor
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&twoFactor.UserID,
+		&twoFactor.CreatedAt,
+		&twoFactor.Secret,
+		&twoFactor.ConfirmedAt,
+		&twoFactor.LastUsedStep,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &twoFactor, nil
+}
+
+// Confirm enables two-factor authentication for the user, recording the time step of
+// the code used to confirm it, and returns new recovery codes replacing any previous
+// ones. The codes can't be retrieved afterwards.
+func (m TwoFactorModel) Confirm(userID, step int64) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE users_two_factor
+		SET confirmed_at = NOW(), last_used_step = $2
+		WHERE user_id = $1 AND confirmed_at IS NULL`
+
+	result, err := tx.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	query = `
+		DELETE FROM two_factor_recovery_codes
+		WHERE user_id = $1`
+
+	_, err = tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		INSERT INTO two_factor_recovery_codes (user_id, hash)
+		VALUES ($1, $2)`
+
+	for _, hash := range hashes {
+		_, err = tx.ExecContext(ctx, query, userID, hash)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// UseStep records that a code of the given time step was used, reporting false if a
+// code of this step or a later one was used already, so that a code can't be replayed.
+func (m TwoFactorModel) UseStep(userID, step int64) (bool, error) {
+	query := `
+		UPDATE users_two_factor
+		SET last_used_step = $2
+		WHERE user_id = $1 AND last_used_step < $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode marks the recovery code of the user as used, reporting false if it
+// doesn't exist or was used already.
+func (m TwoFactorModel) UseRecoveryCode(userID int64, code string) (bool, error) {
+	hash := sha256.Sum256([]byte(NormalizeRecoveryCode(code)))
+
+	query := `
+		UPDATE two_factor_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND hash = $2 AND used_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, hash[:])
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// Delete disables two-factor authentication for the user, deleting the recovery codes.
+func (m TwoFactorModel) Delete(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM two_factor_recovery_codes
+		WHERE user_id = $1`
+
+	_, err = tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		DELETE FROM users_two_factor
+		WHERE user_id = $1`
+
+	_, err = tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
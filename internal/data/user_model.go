@@ -5,6 +5,8 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
+	"github.com/lib/pq"
 	"time"
 )
 
@@ -40,11 +42,49 @@ func (m UserModel) Insert(user *User) error {
 	return nil
 }
 
+// Get retrieve the user details from the database based on the user's ID.
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, name, email, password_hash, activated, deactivated, version
+		FROM users
+		WHERE id = $1`
+
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Deactivated,
+		&user.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
 // GetByEmail retrieve the user details from the database based on the user's
 // email address.
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-		SELECT id, created_at, name, email, password_hash, activated, version
+		SELECT id, created_at, name, email, password_hash, activated, deactivated, version
 		FROM users
 		WHERE email = $1`
 
@@ -59,6 +99,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Deactivated,
 		&user.Version,
 	)
 
@@ -74,12 +115,67 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
+// GetAll returns the users matching the filters. The search matches part of the name
+// or email address, and nil filters are ignored.
+func (m UserModel) GetAll(search string, activated *bool, createdAfter, createdBefore *time.Time, filters Filters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, email, password_hash, activated, deactivated, version
+		FROM users
+		WHERE (name ILIKE '%%' || $1 || '%%' OR email ILIKE '%%' || $1 || '%%' OR $1 = '')
+		AND (activated = $2::boolean OR $2::boolean IS NULL)
+		AND (created_at >= $3::timestamptz OR $3::timestamptz IS NULL)
+		AND (created_at < $4::timestamptz OR $4::timestamptz IS NULL)
+		ORDER BY %s %s, id ASC
+		LIMIT $5 OFFSET $6`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{search, activated, createdAfter, createdBefore, filters.limit(), filters.offset()}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	users := []*User{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Password.hash,
+			&user.Activated,
+			&user.Deactivated,
+			&user.Version,
+		)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return users, metadata, nil
+}
+
 // Update the details for a specific user.
 func (m UserModel) Update(user *User) error {
 	query := `
 		UPDATE users
-		SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-		WHERE id = $5 AND version = $6
+		SET name = $1, email = $2, password_hash = $3, activated = $4, deactivated = $5, version = version + 1
+		WHERE id = $6 AND version = $7
 		RETURNING version`
 
 	args := []any{
@@ -87,6 +183,7 @@ func (m UserModel) Update(user *User) error {
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.Deactivated,
 		user.ID,
 		user.Version,
 	}
@@ -108,20 +205,160 @@ func (m UserModel) Update(user *User) error {
 	return nil
 }
 
+// SetPendingEmail records the new email address of the user until they confirm it,
+// replacing any previous one.
+func (m UserModel) SetPendingEmail(userID int64, email string) error {
+	query := `
+		INSERT INTO users_pending_emails (user_id, email)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET email = EXCLUDED.email, created_at = NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, email)
+	return err
+}
+
+// GetPendingEmail returns the new email address the user has yet to confirm.
+func (m UserModel) GetPendingEmail(userID int64) (string, error) {
+	query := `
+		SELECT email
+		FROM users_pending_emails
+		WHERE user_id = $1`
+
+	var email string
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&email)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+	return email, nil
+}
+
+// DeletePendingEmail deletes the new email address of the user once confirmed.
+func (m UserModel) DeletePendingEmail(userID int64) error {
+	query := `
+		DELETE FROM users_pending_emails
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// ScheduleDeletion schedules the deletion of the user at the given time, keeping the
+// original schedule if one exists. It returns the time the user will be deleted at.
+func (m UserModel) ScheduleDeletion(userID int64, deleteAt time.Time) (time.Time, error) {
+	query := `
+		INSERT INTO users_deletions (user_id, delete_at)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET delete_at = users_deletions.delete_at
+		RETURNING delete_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, deleteAt).Scan(&deleteAt)
+	return deleteAt, err
+}
+
+// GetDeletion returns the time the user is scheduled to be deleted at.
+func (m UserModel) GetDeletion(userID int64) (time.Time, error) {
+	query := `
+		SELECT delete_at
+		FROM users_deletions
+		WHERE user_id = $1`
+
+	var deleteAt time.Time
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&deleteAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return time.Time{}, ErrRecordNotFound
+		default:
+			return time.Time{}, err
+		}
+	}
+	return deleteAt, nil
+}
+
+// CancelDeletion cancels the scheduled deletion of the user. It returns
+// ErrRecordNotFound if no deletion was scheduled.
+func (m UserModel) CancelDeletion(userID int64) error {
+	query := `
+		DELETE FROM users_deletions
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteScheduled deletes the users whose scheduled deletion is due, along with
+// everything they own, returning how many were deleted.
+func (m UserModel) DeleteScheduled() (int64, error) {
+	query := `
+		DELETE FROM users
+		WHERE id IN (SELECT user_id FROM users_deletions WHERE delete_at <= NOW())`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
 // GetForToken returns the details of a particular user associated with the given
-// token scope and the token plain text.
+// token scope and the token plain text. The tokens of deactivated users are ignored.
 func (m UserModel) GetForToken(tokenScope, tokenPlainText string) (*User, error) {
 	// Calculate the SHA-256 hash of plaintext token provided by the client.
 	tokenHash := sha256.Sum256([]byte(tokenPlainText))
 
 	query := `
-		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.deactivated, users.version
 		FROM users
 		INNER JOIN tokens
 		ON users.id = tokens.user_id
 		WHERE tokens.hash = $1
 		AND tokens.scope = $2
-		AND tokens.expiry > $3`
+		AND tokens.expiry > $3
+		AND NOT users.deactivated`
 
 	args := []any{tokenHash[:], tokenScope, time.Now()}
 	var user User
@@ -136,6 +373,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlainText string) (*User, error)
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Deactivated,
 		&user.Version,
 	)
 
@@ -149,3 +387,113 @@ func (m UserModel) GetForToken(tokenScope, tokenPlainText string) (*User, error)
 	}
 	return &user, nil
 }
+
+// GetForSession returns the details of the user associated with the given plaintext
+// authentication token, along with the session the token represents. The tokens of
+// deactivated users are ignored.
+func (m UserModel) GetForSession(tokenPlainText string) (*User, *Session, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	query := `
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.deactivated, users.version,
+			tokens.id, tokens.created_at, tokens.last_used_at, tokens.expiry, tokens.ip, tokens.user_agent,
+			COALESCE(tokens.client_id, 0), tokens.scopes
+		FROM users
+		INNER JOIN tokens
+		ON users.id = tokens.user_id
+		WHERE tokens.hash = $1
+		AND tokens.scope = $2
+		AND tokens.expiry > $3
+		AND NOT users.deactivated`
+
+	args := []any{tokenHash[:], ScopeAuthentication, time.Now()}
+	var user User
+	session := Session{Current: true}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Deactivated,
+		&user.Version,
+		&session.ID,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.Expiry,
+		&session.IP,
+		&session.UserAgent,
+		&session.ClientID,
+		pq.Array(&session.Scopes),
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+	return &user, &session, nil
+}
+
+// GetForAPIKey returns the details of the user owning the given plaintext API key,
+// along with the key. The keys of deactivated users, and of users whose deletion is
+// scheduled, are ignored. The keys of the latter work again if the deletion is
+// cancelled.
+func (m UserModel) GetForAPIKey(keyPlainText string) (*User, *APIKey, error) {
+	keyHash := sha256.Sum256([]byte(keyPlainText))
+
+	query := `
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.deactivated, users.version,
+			api_keys.id, api_keys.created_at, api_keys.name, api_keys.prefix, api_keys.permissions,
+			api_keys.allowed_ips, api_keys.last_used_at
+		FROM users
+		INNER JOIN api_keys
+		ON users.id = api_keys.user_id
+		WHERE api_keys.hash = $1
+		AND NOT users.deactivated
+		AND NOT EXISTS (SELECT 1 FROM users_deletions WHERE users_deletions.user_id = users.id)`
+
+	var user User
+	var key APIKey
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, keyHash[:]).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Deactivated,
+		&user.Version,
+		&key.ID,
+		&key.CreatedAt,
+		&key.Name,
+		&key.Prefix,
+		pq.Array(&key.Permissions),
+		pq.Array(&key.AllowedIPs),
+		&key.LastUsedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	key.UserID = user.ID
+	return &user, &key, nil
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"github.com/hayohtee/greenlight/internal/validator"
 	"golang.org/x/crypto/bcrypt"
+	"sync"
 	"time"
 )
 
@@ -12,13 +13,14 @@ var AnonymousUser = &User{}
 
 // User is a type that represent individual user.
 type User struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Password  password  `json:"-"`
-	Activated bool      `json:"activated"`
-	Version   int       `json:"-"`
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Name        string    `json:"name"`
+	Email       string    `json:"email"`
+	Password    password  `json:"-"`
+	Activated   bool      `json:"activated"`
+	Deactivated bool      `json:"deactivated"`
+	Version     int       `json:"-"`
 }
 
 // IsAnonymous check if a user instance is anonymous user.
@@ -62,6 +64,25 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 	return true, nil
 }
 
+// dummyPassword is checked against when no user has the email address of a login, so
+// that logins take as long whether or not the address is registered.
+var dummyPassword = sync.OnceValue(func() *password {
+	var p password
+	_ = p.Set("greenlight dummy password")
+	return &p
+})
+
+// SimulatePasswordCheck spends as long as checking the password of a user.
+func SimulatePasswordCheck(plaintextPassword string) {
+	_, _ = dummyPassword().Matches(plaintextPassword)
+}
+
+// RandomPassword returns a new unguessable password, for the users created without
+// choosing one.
+func RandomPassword() (string, error) {
+	return randomString()
+}
+
 // ValidateEmail ensures that the provided email is not empty, and it is
 // a valid email address.
 func ValidateEmail(v *validator.Validator, email string) {
@@ -0,0 +1,331 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+)
+
+// WebhookModel is a struct that wraps a sql.DB connection pool and provides methods
+// for interacting with the webhooks and webhook_deliveries tables in the database.
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+// Insert a new webhook into the database.
+func (m WebhookModel) Insert(webhook *Webhook) error {
+	query := `
+		INSERT INTO webhooks (user_id, url, events, secret, active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, version`
+
+	args := []any{webhook.UserID, webhook.URL, pq.Array(webhook.Events), webhook.Secret, webhook.Active}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.ID, &webhook.CreatedAt, &webhook.Version)
+}
+
+// Get a specific webhook from the database or return an error.
+func (m WebhookModel) Get(id int64) (*Webhook, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, user_id, url, events, secret, active, version
+		FROM webhooks
+		WHERE id = $1`
+
+	var webhook Webhook
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&webhook.ID,
+		&webhook.CreatedAt,
+		&webhook.UserID,
+		&webhook.URL,
+		pq.Array(&webhook.Events),
+		&webhook.Secret,
+		&webhook.Active,
+		&webhook.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &webhook, nil
+}
+
+// GetAllForUser returns the webhooks owned by a specific user matching the filters.
+func (m WebhookModel) GetAllForUser(userID int64, filters Filters) ([]*Webhook, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, user_id, url, events, secret, active, version
+		FROM webhooks
+		WHERE user_id = $1
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var webhook Webhook
+		err := rows.Scan(
+			&totalRecords,
+			&webhook.ID,
+			&webhook.CreatedAt,
+			&webhook.UserID,
+			&webhook.URL,
+			pq.Array(&webhook.Events),
+			&webhook.Secret,
+			&webhook.Active,
+			&webhook.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return webhooks, metadata, nil
+}
+
+// Update the details for a specific webhook.
+func (m WebhookModel) Update(webhook *Webhook) error {
+	query := `
+		UPDATE webhooks
+		SET url = $1, events = $2, secret = $3, active = $4, version = version + 1
+		WHERE id = $5 AND version = $6
+		RETURNING version`
+
+	args := []any{webhook.URL, pq.Array(webhook.Events), webhook.Secret, webhook.Active, webhook.ID, webhook.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete a specific webhook, along with its deliveries, from the database.
+func (m WebhookModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM webhooks
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Enqueue queues a delivery of the event, carrying the JSON-encoded data, for every
+// active webhook subscribed to it.
+func (m WebhookModel) Enqueue(event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT id, $1, $2
+		FROM webhooks
+		WHERE active AND events @> ARRAY[$1]`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, event, string(payload))
+	return err
+}
+
+// ClaimDue returns up to limit pending deliveries whose next attempt is due, and
+// pushes their next attempt back by the lease duration. This stops other API
+// instances from picking up the same deliveries while they are being sent, while
+// making sure they are retried if this instance dies before recording the outcome.
+func (m WebhookModel) ClaimDue(limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	query := `
+		WITH due AS (
+			SELECT id
+			FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1, last_attempt_at = NOW(), next_attempt_at = NOW() + make_interval(secs => $2)
+		FROM due, webhooks
+		WHERE webhook_deliveries.id = due.id AND webhooks.id = webhook_deliveries.webhook_id
+		RETURNING webhook_deliveries.id, webhook_deliveries.created_at, webhook_deliveries.webhook_id,
+		          webhook_deliveries.event, webhook_deliveries.payload, webhook_deliveries.status,
+		          webhook_deliveries.attempts, webhook_deliveries.next_attempt_at,
+		          webhook_deliveries.last_attempt_at, webhooks.url, webhooks.secret`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.CreatedAt,
+			&delivery.WebhookID,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.LastAttemptAt,
+			&delivery.URL,
+			&delivery.Secret,
+		)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RecordAttempt saves the outcome of the latest attempt for the delivery. The
+// delivery Status, NextAttemptAt, ResponseStatus and LastError fields are expected
+// to have been updated by the caller.
+func (m WebhookModel) RecordAttempt(delivery *WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, next_attempt_at = $2, response_status = $3, last_error = $4
+		WHERE id = $5`
+
+	args := []any{delivery.Status, delivery.NextAttemptAt, delivery.ResponseStatus, delivery.LastError, delivery.ID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// GetDeliveries returns the delivery log of a specific webhook, optionally filtered
+// by delivery status.
+func (m WebhookModel) GetDeliveries(webhookID int64, status string, filters Filters) ([]*WebhookDelivery, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, webhook_id, event, payload, status, attempts,
+		       next_attempt_at, last_attempt_at, response_status, last_error
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		AND (status = $2 OR $2 = '')
+		ORDER BY %s %s, id DESC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{webhookID, status, filters.limit(), filters.offset()}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err := rows.Scan(
+			&totalRecords,
+			&delivery.ID,
+			&delivery.CreatedAt,
+			&delivery.WebhookID,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.LastAttemptAt,
+			&delivery.ResponseStatus,
+			&delivery.LastError,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return deliveries, metadata, nil
+}
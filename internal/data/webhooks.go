@@ -0,0 +1,105 @@
+package data
+
+import (
+	"encoding/json"
+	"github.com/hayohtee/greenlight/internal/validator"
+	"github.com/hayohtee/greenlight/internal/webhook"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Define constants for the events webhooks can subscribe to.
+const (
+	EventMovieCreated  = "movie.created"
+	EventMovieUpdated  = "movie.updated"
+	EventMovieDeleted  = "movie.deleted"
+	EventUserActivated = "user.activated"
+)
+
+// WebhookEvents holds every event a webhook can subscribe to.
+var WebhookEvents = []string{EventMovieCreated, EventMovieUpdated, EventMovieDeleted, EventUserActivated}
+
+// Define constants for the status of a webhook delivery.
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusFailed    = "failed"
+)
+
+// Webhook is a type that represent a subscription of a target URL to a set of events.
+type Webhook struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    int64     `json:"-"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	Active    bool      `json:"active"`
+	Version   int32     `json:"version"`
+}
+
+// WebhookDelivery is a type that represent a single event queued for delivery
+// to a webhook, along with the outcome of the latest attempt.
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	WebhookID      int64           `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+
+	// URL and Secret are copied from the webhook when a delivery is claimed.
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// GenerateWebhookSecret returns a new random secret for signing webhook payloads.
+func GenerateWebhookSecret() (string, error) {
+	return randomString()
+}
+
+// ValidateWebhook adds validation check on the webhook.
+func ValidateWebhook(v *validator.Validator, webhook *Webhook) {
+	v.Check(webhook.URL != "", "url", "must be provided")
+	v.Check(len(webhook.URL) <= 2000, "url", "must not be more than 2000 bytes long")
+
+	u, err := url.Parse(webhook.URL)
+	v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", "must be an absolute http or https URL")
+	if err == nil {
+		v.Check(publicHost(u.Hostname()), "url", "must not target a local, private or reserved address")
+	}
+
+	v.Check(webhook.Events != nil, "events", "must be provided")
+	v.Check(len(webhook.Events) >= 1, "events", "must contain at least 1 event")
+	v.Check(validator.Unique(webhook.Events), "events", "must not contain duplicate values")
+	for _, event := range webhook.Events {
+		v.Check(validator.PermittedValue(event, WebhookEvents...), "events", "contains an unknown event "+event)
+	}
+
+	v.Check(len(webhook.Secret) >= 16, "secret", "must be at least 16 bytes long")
+	v.Check(len(webhook.Secret) <= 200, "secret", "must not be more than 200 bytes long")
+}
+
+// publicHost reports whether the host of a webhook URL may be public. Host names are
+// only checked against the well-known local ones here, the addresses they resolve to
+// are checked when the webhook is delivered.
+func publicHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return true
+	}
+
+	return webhook.PublicAddr(addr)
+}
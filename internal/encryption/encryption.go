@@ -0,0 +1,64 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+// ErrDecryption is returned when a ciphertext can't be decrypted, because it was
+// encrypted with another key or has been tampered with.
+var ErrDecryption = errors.New("encryption: message authentication failed")
+
+// Cipher encrypts secrets stored in the database with AES-256-GCM, so that reading the
+// database alone doesn't reveal them.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// New returns a Cipher using the given 32 bytes key.
+func New(key []byte) (*Cipher, error) {
+	if len(key) != 32 {
+		return nil, errors.New("encryption: the key must be 32 bytes long")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cipher{aead: aead}, nil
+}
+
+// Encrypt returns the ciphertext of the plaintext, prefixed with its random nonce.
+func (c *Cipher) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt returns the plaintext of a ciphertext returned by Encrypt.
+func (c *Cipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	size := c.aead.NonceSize()
+	if len(ciphertext) < size {
+		return nil, ErrDecryption
+	}
+
+	plaintext, err := c.aead.Open(nil, ciphertext[:size], ciphertext[size:], nil)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,154 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func secret(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func mustParseKeyRing(t *testing.T, s string) *KeyRing {
+	t.Helper()
+
+	ring, err := ParseKeyRing(s)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return ring
+}
+
+func TestSignVerify(t *testing.T) {
+	ring := mustParseKeyRing(t, "k1:"+secret('a'))
+	now := time.Unix(1_700_000_000, 0)
+
+	claims := Claims{
+		Subject:   "42",
+		ExpiresAt: now.Add(time.Minute).Unix(),
+		IssuedAt:  now.Unix(),
+		ID:        "7",
+		Scope:     "authentication",
+		Activated: true,
+	}
+
+	token, err := ring.Sign(claims)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !LooksLikeToken(token) {
+		t.Errorf("got token %q which doesn't look like a JWT", token)
+	}
+
+	got, err := ring.Verify(token, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *got != claims {
+		t.Errorf("got claims %+v; want %+v", *got, claims)
+	}
+
+	_, err = ring.Verify(token, now.Add(time.Minute))
+	if !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("got error %v once expired; want %v", err, ErrExpiredToken)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	claims := Claims{Subject: "42", ExpiresAt: now.Add(time.Minute).Unix()}
+
+	old := mustParseKeyRing(t, "k1:"+secret('a'))
+	token, err := old.Sign(claims)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A token signed with the previous key is accepted until the key is removed.
+	rotated := mustParseKeyRing(t, "k2:"+secret('b')+" k1:"+secret('a'))
+	_, err = rotated.Verify(token, now)
+	if err != nil {
+		t.Errorf("got error %v with the previous key in the ring", err)
+	}
+
+	removed := mustParseKeyRing(t, "k2:"+secret('b'))
+	_, err = removed.Verify(token, now)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("got error %v without the previous key; want %v", err, ErrInvalidToken)
+	}
+
+	// New tokens are signed with the first key of the ring.
+	token, err = rotated.Sign(claims)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = removed.Verify(token, now)
+	if err != nil {
+		t.Errorf("got error %v for a token signed with the current key", err)
+	}
+}
+
+func TestVerifyInvalidToken(t *testing.T) {
+	ring := mustParseKeyRing(t, "k1:"+secret('a'))
+	now := time.Unix(1_700_000_000, 0)
+
+	token, err := ring.Sign(Claims{Subject: "42", ExpiresAt: now.Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parts := strings.Split(token, ".")
+
+	forged, err := mustParseKeyRing(t, "k1:"+secret('b')).Sign(Claims{Subject: "1", ExpiresAt: now.Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"two parts", parts[0] + "." + parts[1]},
+		{"tampered claims", parts[0] + "." + encode([]byte(`{"sub":"1","exp":9999999999}`)) + "." + parts[2]},
+		{"tampered signature", parts[0] + "." + parts[1] + "." + encode([]byte("signature"))},
+		{"other key", forged},
+		{"unknown key ID", encode([]byte(`{"alg":"HS256","typ":"JWT","kid":"k9"}`)) + "." + parts[1] + "." + parts[2]},
+		{"none algorithm", encode([]byte(`{"alg":"none","typ":"JWT","kid":"k1"}`)) + "." + parts[1] + "."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ring.Verify(tt.token, now)
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("got error %v; want %v", err, ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestParseKeyRingErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		keys string
+	}{
+		{"empty", ""},
+		{"missing separator", secret('a')},
+		{"missing key ID", ":" + secret('a')},
+		{"not base64", "k1:not-base64!"},
+		{"too short", "k1:" + base64.StdEncoding.EncodeToString([]byte("short"))},
+		{"duplicate key ID", "k1:" + secret('a') + " k1:" + secret('b')},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseKeyRing(tt.keys)
+			if err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
@@ -0,0 +1,395 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidIDToken is returned when an ID token is malformed, has an invalid
+	// signature, or claims which don't match the request it answers.
+	ErrInvalidIDToken = errors.New("invalid ID token")
+
+	// ErrCodeRejected is returned when the provider refuses to exchange an authorization
+	// code, which is usually expired or already used.
+	ErrCodeRejected = errors.New("authorization code rejected")
+)
+
+// clockSkew is the leeway allowed between the clocks of the provider and the server
+// when checking the expiry of an ID token.
+const clockSkew = time.Minute
+
+// keysRefreshInterval is the minimum time between two reloads of the provider keys,
+// so that tokens with unknown key IDs can't be used to flood the provider.
+const keysRefreshInterval = time.Minute
+
+// Claims holds the ID token claims used by the application. EmailVerified is false
+// when the provider doesn't vouch for the email address.
+type Claims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp"`
+	ExpiresAt       int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce"`
+	Email           string   `json:"email"`
+	EmailVerified   bool     `json:"email_verified"`
+	Name            string   `json:"name"`
+}
+
+// audience is the aud claim, which is either a single string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if json.Unmarshal(b, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(b, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, aud := range a {
+		if aud == s {
+			return true
+		}
+	}
+	return false
+}
+
+// metadata holds the fields of the discovery document used by the application.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// Provider is an OpenID Connect provider the application delegates logins to, as a
+// relying party using the authorization code flow with PKCE. The discovery document
+// and keys of the provider are fetched on first use and cached, the keys being
+// reloaded when a token is signed with an unknown one.
+type Provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURI  string
+	client       *http.Client
+
+	mu              sync.Mutex
+	metadata        *metadata
+	keys            map[string]*rsa.PublicKey
+	keysRefreshedAt time.Time
+}
+
+// New returns a provider identified by its issuer URL. The client secret is empty for
+// public clients. The HTTP client is used for every request to the provider.
+func New(issuer, clientID, clientSecret, redirectURI string, client *http.Client) *Provider {
+	return &Provider{
+		issuer:       strings.TrimSuffix(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURI:  redirectURI,
+		client:       client,
+	}
+}
+
+// Issuer returns the issuer URL of the provider.
+func (p *Provider) Issuer() string {
+	return p.issuer
+}
+
+// AuthCodeURL returns the URL to send the user to for them to log in with the
+// provider, which then redirects them to the redirect URI with a code and the state.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(m.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("oidc: invalid authorization endpoint: %w", err)
+	}
+
+	qs := u.Query()
+	qs.Set("response_type", "code")
+	qs.Set("client_id", p.clientID)
+	qs.Set("redirect_uri", p.redirectURI)
+	qs.Set("scope", "openid email profile")
+	qs.Set("state", state)
+	qs.Set("nonce", nonce)
+	qs.Set("code_challenge", CodeChallenge(codeVerifier))
+	qs.Set("code_challenge_method", "S256")
+	u.RawQuery = qs.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange trades the authorization code for the tokens of the user, returning the
+// claims of the ID token once verified against the nonce of the login.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURI},
+		"code_verifier": {codeVerifier},
+	}
+	if p.clientSecret == "" {
+		form.Set("client_id", p.clientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	// The provider answers 400 Bad Request for invalid codes, and 401 Unauthorized
+	// if the client credentials are wrong, which is a configuration error.
+	if res.StatusCode == http.StatusBadRequest {
+		return nil, ErrCodeRejected
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: token endpoint responded with status %d", res.StatusCode)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	err = json.NewDecoder(io.LimitReader(res.Body, 1_048_576)).Decode(&tokens)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: invalid token response: %w", err)
+	}
+
+	return p.Verify(ctx, tokens.IDToken, nonce, time.Now())
+}
+
+// Verify checks the signature of the ID token against the keys of the provider, and
+// that it was issued by the provider to this client for the login with the nonce.
+func (p *Provider) Verify(ctx context.Context, idToken, nonce string, now time.Time) (*Claims, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIDToken
+	}
+
+	var h header
+	if err := decode(parts[0], &h); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	// RS256 is the algorithm every provider must support. Any other is refused rather
+	// than trusting the one the token claims.
+	if h.Algorithm != "RS256" {
+		return nil, ErrInvalidIDToken
+	}
+
+	key, err := p.key(ctx, h.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	var claims Claims
+	if err := decode(parts[1], &claims); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	switch {
+	case strings.TrimSuffix(claims.Issuer, "/") != p.issuer:
+		return nil, ErrInvalidIDToken
+	case !claims.Audience.contains(p.clientID):
+		return nil, ErrInvalidIDToken
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.clientID:
+		return nil, ErrInvalidIDToken
+	case claims.Subject == "":
+		return nil, ErrInvalidIDToken
+	case now.Add(-clockSkew).Unix() >= claims.ExpiresAt:
+		return nil, ErrInvalidIDToken
+	case claims.IssuedAt > now.Add(clockSkew).Unix():
+		return nil, ErrInvalidIDToken
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, ErrInvalidIDToken
+	}
+
+	return &claims, nil
+}
+
+// CodeChallenge returns the S256 PKCE challenge of the code verifier.
+func CodeChallenge(codeVerifier string) string {
+	hash := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// discover returns the discovery document of the provider, fetching it on first use.
+// The issuer it declares must be the configured one, as required by the
+// specification, so that a document served from elsewhere can't redirect logins.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var m metadata
+	err := p.get(ctx, p.issuer+"/.well-known/openid-configuration", &m)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSuffix(m.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("oidc: discovery document issuer %q doesn't match %q", m.Issuer, p.issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document is missing endpoints")
+	}
+
+	p.metadata = &m
+	return p.metadata, nil
+}
+
+// key returns the public key with the given ID, reloading the keys of the provider if
+// it isn't known, as providers rotate their keys.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(p.keysRefreshedAt) < keysRefreshInterval {
+		return nil, ErrInvalidIDToken
+	}
+
+	var set struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			Use     string `json:"use"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+		} `json:"keys"`
+	}
+	err = p.get(ctx, m.JWKSURI, &set)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.KeyType != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+
+		n, err1 := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err1 != nil || err2 != nil || len(n) < 256 || len(e) > 4 {
+			continue
+		}
+
+		keys[jwk.KeyID] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	p.keys = keys
+	p.keysRefreshedAt = time.Now()
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, ErrInvalidIDToken
+	}
+	return key, nil
+}
+
+// get fetches the JSON document at the URL into dst.
+func (p *Provider) get(ctx context.Context, url string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: %s responded with status %d", url, res.StatusCode)
+	}
+
+	err = json.NewDecoder(io.LimitReader(res.Body, 1_048_576)).Decode(dst)
+	if err != nil {
+		return fmt.Errorf("oidc: invalid response from %s: %w", url, err)
+	}
+	return nil
+}
+
+func decode(s string, dst any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
@@ -0,0 +1,313 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hayohtee/greenlight/internal/oidc"
+	"github.com/hayohtee/greenlight/internal/oidc/oidctest"
+)
+
+const (
+	clientID    = "greenlight"
+	redirectURI = "https://greenlight.example.com/login/callback"
+	verifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+func newProvider(t *testing.T, clientSecret string) (*oidctest.Provider, *oidc.Provider) {
+	t.Helper()
+
+	fake, err := oidctest.NewProvider(clientID, clientSecret, redirectURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(fake.Close)
+
+	return fake, oidc.New(fake.URL, clientID, clientSecret, redirectURI, fake.Client())
+}
+
+// login goes through the authorization code flow, the user logging in with the given
+// claims at the authorization URL, and returns the result of the code exchange.
+func login(t *testing.T, fake *oidctest.Provider, provider *oidc.Provider, nonce string, claims map[string]any) (*oidc.Claims, error) {
+	t.Helper()
+
+	authorizationURL, err := provider.AuthCodeURL(context.Background(), "state-1", nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state, err := fake.Authorize(authorizationURL, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != "state-1" {
+		t.Fatalf("got state %q; want %q", state, "state-1")
+	}
+
+	return provider.Exchange(context.Background(), code, verifier, nonce)
+}
+
+func TestLogin(t *testing.T) {
+	for _, clientSecret := range []string{"", "s3cr3t:with/special&chars"} {
+		name := "public client"
+		if clientSecret != "" {
+			name = "confidential client"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			fake, provider := newProvider(t, clientSecret)
+
+			claims, err := login(t, fake, provider, "nonce-1", map[string]any{
+				"sub":            "user-42",
+				"email":          "alice@example.com",
+				"email_verified": true,
+				"name":           "Alice",
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if claims.Subject != "user-42" || claims.Email != "alice@example.com" || !claims.EmailVerified || claims.Name != "Alice" {
+				t.Errorf("got claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	fake, provider := newProvider(t, "")
+
+	authorizationURL, err := provider.AuthCodeURL(context.Background(), "state-1", "nonce-1", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             clientID,
+		"redirect_uri":          redirectURI,
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        oidc.CodeChallenge(verifier),
+		"code_challenge_method": "S256",
+	}
+	for key, value := range want {
+		if got := u.Query().Get(key); got != value {
+			t.Errorf("got %s %q; want %q", key, got, value)
+		}
+	}
+
+	if !strings.Contains(u.Query().Get("scope"), "openid") {
+		t.Errorf("got scope %q; want the openid scope", u.Query().Get("scope"))
+	}
+	if !strings.HasPrefix(authorizationURL, fake.URL+"/authorize?") {
+		t.Errorf("got URL %q; want the authorization endpoint of the provider", authorizationURL)
+	}
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// Example from RFC 7636, appendix B.
+	if got, want := oidc.CodeChallenge(verifier), "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestExchangeRejectedCode(t *testing.T) {
+	fake, provider := newProvider(t, "")
+
+	authorizationURL, err := provider.AuthCodeURL(context.Background(), "state-1", "nonce-1", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, err := fake.Authorize(authorizationURL, map[string]any{"sub": "user-42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		verifier string
+	}{
+		{"unknown code", "unknown", verifier},
+		{"wrong code verifier", code, strings.Repeat("x", 43)},
+		// The code was used by the previous attempt.
+		{"reused code", code, verifier},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.Exchange(context.Background(), tt.code, tt.verifier, "nonce-1")
+			if !errors.Is(err, oidc.ErrCodeRejected) {
+				t.Errorf("got error %v; want %v", err, oidc.ErrCodeRejected)
+			}
+		})
+	}
+}
+
+func TestExchangeInvalidClientSecret(t *testing.T) {
+	fake, _ := newProvider(t, "s3cr3t")
+	provider := oidc.New(fake.URL, clientID, "wrong", redirectURI, fake.Client())
+
+	_, err := login(t, fake, provider, "nonce-1", map[string]any{"sub": "user-42"})
+	if err == nil || errors.Is(err, oidc.ErrCodeRejected) || errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Errorf("got error %v; want a configuration error", err)
+	}
+}
+
+func TestExchangeInvalidIDToken(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		claims map[string]any
+	}{
+		{"wrong nonce", map[string]any{"nonce": "nonce-2"}},
+		{"missing nonce", map[string]any{"nonce": ""}},
+		{"wrong issuer", map[string]any{"iss": "https://evil.example.com"}},
+		{"wrong audience", map[string]any{"aud": "another-client"}},
+		{"other authorized party", map[string]any{"aud": []string{clientID, "another-client"}, "azp": "another-client"}},
+		{"expired", map[string]any{"exp": now.Add(-time.Hour).Unix()}},
+		{"issued in the future", map[string]any{"iat": now.Add(time.Hour).Unix()}},
+		{"missing subject", map[string]any{"sub": ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, provider := newProvider(t, "")
+
+			claims := map[string]any{"sub": "user-42"}
+			for key, value := range tt.claims {
+				claims[key] = value
+			}
+
+			_, err := login(t, fake, provider, "nonce-1", claims)
+			if !errors.Is(err, oidc.ErrInvalidIDToken) {
+				t.Errorf("got error %v; want %v", err, oidc.ErrInvalidIDToken)
+			}
+		})
+	}
+}
+
+func TestExchangeMultipleAudiences(t *testing.T) {
+	fake, provider := newProvider(t, "")
+
+	_, err := login(t, fake, provider, "nonce-1", map[string]any{
+		"sub": "user-42",
+		"aud": []string{clientID, "another-client"},
+		"azp": clientID,
+	})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	fake, provider := newProvider(t, "")
+
+	claims := map[string]any{
+		"iss":   fake.URL,
+		"aud":   clientID,
+		"sub":   "user-42",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": "nonce-1",
+	}
+
+	valid, err := fake.SignIDToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = provider.Verify(context.Background(), valid, "nonce-1", time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	forger, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Signed by another key, claiming the ID of the key of the provider.
+	forged, err := oidctest.Sign(forger, "key-1", claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Signed with an unknown key, which makes the provider keys reload at most once a
+	// minute.
+	unknown, err := oidctest.Sign(forger, "key-2", claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := map[string]any{"sub": "user-1"}
+	for key, value := range claims {
+		if key != "sub" {
+			other[key] = value
+		}
+	}
+
+	// Claims of another user, to swap in the valid token.
+	tampered, err := oidctest.Sign(forger, "key-1", other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(valid, ".")
+
+	tests := []struct {
+		name    string
+		idToken string
+	}{
+		{"forged signature", forged},
+		{"unknown key", unknown},
+		{"tampered claims", parts[0] + "." + strings.Split(tampered, ".")[1] + "." + parts[2]},
+		{"missing signature", parts[0] + "." + parts[1] + "."},
+		{"unsigned", "eyJhbGciOiJub25lIn0." + parts[1] + "."},
+		{"malformed", "not-a-token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.Verify(context.Background(), tt.idToken, "nonce-1", time.Now())
+			if !errors.Is(err, oidc.ErrInvalidIDToken) {
+				t.Errorf("got error %v; want %v", err, oidc.ErrInvalidIDToken)
+			}
+		})
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	fake, provider := newProvider(t, "")
+	fake.DiscoveryIssuer = "https://evil.example.com"
+
+	_, err := provider.AuthCodeURL(context.Background(), "state-1", "nonce-1", verifier)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestDiscoveryUnavailable(t *testing.T) {
+	fake, provider := newProvider(t, "")
+	fake.Config.Handler = http.NotFoundHandler()
+
+	_, err := provider.AuthCodeURL(context.Background(), "state-1", "nonce-1", verifier)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,251 @@
+// Package oidctest provides a fake OpenID Connect provider, served by an
+// httptest.Server, to test logins with an external provider.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider is a fake OpenID Connect provider supporting discovery, the authorization
+// code flow with PKCE and RS256 signed ID tokens. Users don't log in interactively:
+// Authorize stands for the user logging in at the authorization URL.
+type Provider struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+
+	// DiscoveryIssuer overrides the issuer declared by the discovery document, which
+	// is the URL of the server otherwise.
+	DiscoveryIssuer string
+
+	mu    sync.Mutex
+	key   *rsa.PrivateKey
+	kid   string
+	codes map[string]*grant
+}
+
+// grant holds what the provider knows about an authorization code.
+type grant struct {
+	claims    map[string]any
+	challenge string
+	used      bool
+}
+
+// NewProvider starts a provider with a single client. The client secret is empty for
+// public clients. The provider must be closed once done with.
+func NewProvider(clientID, clientSecret, redirectURI string) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURI:  redirectURI,
+		key:          key,
+		kid:          "key-1",
+		codes:        make(map[string]*grant),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discoveryHandler)
+	mux.HandleFunc("GET /jwks", p.keysHandler)
+	mux.HandleFunc("POST /token", p.tokenHandler)
+	p.Server = httptest.NewServer(mux)
+
+	return p, nil
+}
+
+// Authorize stands for the user logging in at the authorization URL, returning the
+// code and state the provider redirects them back with. The ID token issued for the
+// code has the standard claims for the login, overridden by the given ones.
+func (p *Provider) Authorize(authorizationURL string, claims map[string]any) (code, state string, err error) {
+	u, err := url.Parse(authorizationURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	qs := u.Query()
+	switch {
+	case !strings.HasPrefix(authorizationURL, p.URL+"/authorize?"):
+		return "", "", errors.New("oidctest: unknown authorization endpoint")
+	case qs.Get("response_type") != "code":
+		return "", "", errors.New("oidctest: unsupported response type")
+	case qs.Get("client_id") != p.ClientID:
+		return "", "", errors.New("oidctest: unknown client")
+	case qs.Get("redirect_uri") != p.RedirectURI:
+		return "", "", errors.New("oidctest: unknown redirect URI")
+	case qs.Get("code_challenge_method") != "S256" || qs.Get("code_challenge") == "":
+		return "", "", errors.New("oidctest: missing S256 code challenge")
+	}
+
+	now := time.Now()
+	idClaims := map[string]any{
+		"iss":   p.URL,
+		"aud":   p.ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": qs.Get("nonce"),
+	}
+	for key, value := range claims {
+		idClaims[key] = value
+	}
+
+	code = randomString()
+
+	p.mu.Lock()
+	p.codes[code] = &grant{claims: idClaims, challenge: qs.Get("code_challenge")}
+	p.mu.Unlock()
+
+	return code, qs.Get("state"), nil
+}
+
+// SignIDToken returns an ID token with the claims, signed with the current key of the
+// provider.
+func (p *Provider) SignIDToken(claims map[string]any) (string, error) {
+	p.mu.Lock()
+	key, kid := p.key, p.kid
+	p.mu.Unlock()
+
+	return Sign(key, kid, claims)
+}
+
+// Sign returns an RS256 signed token with the claims, signed with the key.
+func Sign(key *rsa.PrivateKey, kid string, claims map[string]any) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (p *Provider) discoveryHandler(w http.ResponseWriter, r *http.Request) {
+	issuer := p.DiscoveryIssuer
+	if issuer == "" {
+		issuer = p.URL
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                 issuer,
+		"authorization_endpoint": p.URL + "/authorize",
+		"token_endpoint":         p.URL + "/token",
+		"jwks_uri":               p.URL + "/jwks",
+	})
+}
+
+func (p *Provider) keysHandler(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	key, kid := p.key, p.kid
+	p.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+}
+
+// tokenHandler exchanges an authorization code for an ID token, once the client is
+// authenticated and the PKCE code verifier matches the challenge of the login.
+func (p *Provider) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+	}
+
+	if clientID != p.ClientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(p.ClientSecret)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	g, ok := p.codes[r.PostForm.Get("code")]
+	valid := ok && !g.used && r.PostForm.Get("redirect_uri") == p.RedirectURI &&
+		challenge(r.PostForm.Get("code_verifier")) == g.challenge
+	if ok {
+		// Codes can only be tried once.
+		g.used = true
+	}
+	p.mu.Unlock()
+
+	if !valid {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := p.SignIDToken(g.claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func challenge(codeVerifier string) string {
+	hash := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,131 @@
+package passwords
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// prefixes is the number of 4 hex digits SHA-1 prefixes the corpus is indexed by.
+const prefixes = 1 << 16
+
+// Corpus is a list of breached passwords read from a local file, in the format of the
+// Pwned Passwords downloads ordered by hash: one uppercase hex SHA-1 hash per line,
+// optionally followed by a colon and a count, sorted by hash. The file is indexed by
+// the hash prefixes when opened, so that a lookup only reads the lines sharing the
+// prefix of the password hash, without loading the corpus in memory.
+type Corpus struct {
+	file *os.File
+	// offsets holds the offset of the first line of each prefix, and the size of the
+	// file as the last element, so that the lines of prefix i are found between
+	// offsets[i] and offsets[i+1].
+	offsets []int64
+}
+
+// Open reads the corpus file at the path and builds its index.
+func Open(path string) (*Corpus, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets, err := index(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("passwords: %s: %w", path, err)
+	}
+
+	return &Corpus{file: file, offsets: offsets}, nil
+}
+
+func index(r io.Reader) ([]int64, error) {
+	offsets := make([]int64, prefixes+1)
+
+	var (
+		offset int64
+		next   int
+		prev   []byte
+		line   int
+	)
+
+	reader := bufio.NewReader(r)
+	for {
+		b, err := reader.ReadBytes('\n')
+		if len(b) > 0 {
+			line++
+
+			hash, _, _ := bytes.Cut(bytes.TrimRight(b, "\r\n"), []byte(":"))
+			if len(hash) != 2*sha1.Size {
+				return nil, fmt.Errorf("line %d: not a SHA-1 hash", line)
+			}
+			hash = bytes.ToUpper(hash)
+
+			var prefix [2]byte
+			if _, err := hex.Decode(prefix[:], hash[:4]); err != nil {
+				return nil, fmt.Errorf("line %d: not a SHA-1 hash", line)
+			}
+			if bytes.Compare(hash, prev) < 0 {
+				return nil, fmt.Errorf("line %d: hashes must be sorted", line)
+			}
+			prev = hash
+
+			// Every prefix up to this one starts here, the ones without any hash
+			// being empty.
+			for p := int(prefix[0])<<8 | int(prefix[1]); next <= p; next++ {
+				offsets[next] = offset
+			}
+
+			offset += int64(len(b))
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for ; next <= prefixes; next++ {
+		offsets[next] = offset
+	}
+
+	return offsets, nil
+}
+
+// Contains reports whether the password is in the corpus.
+func (c *Corpus) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := bytes.ToUpper([]byte(hex.EncodeToString(sum[:])))
+
+	p := int(sum[0])<<8 | int(sum[1])
+	start, end := c.offsets[p], c.offsets[p+1]
+	if start == end {
+		return false, nil
+	}
+
+	section := make([]byte, end-start)
+	_, err := c.file.ReadAt(section, start)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+
+	for _, line := range bytes.Split(section, []byte("\n")) {
+		candidate, _, _ := bytes.Cut(bytes.TrimRight(line, "\r"), []byte(":"))
+		if bytes.EqualFold(candidate, hash) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Close closes the corpus file.
+func (c *Corpus) Close() error {
+	return c.file.Close()
+}
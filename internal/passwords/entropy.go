@@ -0,0 +1,65 @@
+package passwords
+
+import (
+	"math"
+	"unicode"
+)
+
+// Entropy estimates the strength of the password in bits, as the number of guesses a
+// brute-force attack would need if it knew the kinds of characters used. Characters
+// repeating or continuing a sequence from the previous one, as in "aaaa" or "1234",
+// barely add to the strength and only count for one bit.
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+
+	if pool == 0 {
+		return 0
+	}
+
+	bitsPerChar := math.Log2(float64(pool))
+
+	var bits float64
+	prev := rune(-1)
+	for _, r := range password {
+		delta := r - prev
+		if delta >= -1 && delta <= 1 {
+			bits++
+		} else {
+			bits += bitsPerChar
+		}
+		prev = r
+	}
+
+	return bits
+}
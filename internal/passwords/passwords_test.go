@@ -0,0 +1,159 @@
+package passwords
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeCorpus writes a corpus file of the passwords, in the Pwned Passwords format,
+// returning its path.
+func writeCorpus(t *testing.T, passwords ...string) string {
+	t.Helper()
+
+	var lines []string
+	for _, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		lines = append(lines, strings.ToUpper(hex.EncodeToString(sum[:]))+":42")
+	}
+	slices.Sort(lines)
+
+	path := filepath.Join(t.TempDir(), "pwned-passwords.txt")
+	err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func openCorpus(t *testing.T, passwords ...string) *Corpus {
+	t.Helper()
+
+	corpus, err := Open(writeCorpus(t, passwords...))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { corpus.Close() })
+	return corpus
+}
+
+func TestCorpusContains(t *testing.T) {
+	corpus := openCorpus(t, "password", "123456", "qwerty", "letmein")
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"password", true},
+		{"123456", true},
+		{"letmein", true},
+		{"Password", false},
+		{"correct horse battery staple", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		got, err := corpus.Contains(tt.password)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("got %t for %q; want %t", got, tt.password, tt.want)
+		}
+	}
+}
+
+func TestOpenInvalidCorpus(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		err      string
+	}{
+		{"not a hash", "password\n", "line 1: not a SHA-1 hash"},
+		{"not hex", strings.Repeat("Z", 40) + "\n", "line 1: not a SHA-1 hash"},
+		{"unsorted", strings.Repeat("B", 40) + ":1\n" + strings.Repeat("A", 40) + ":1\n", "line 2: hashes must be sorted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "corpus.txt")
+			err := os.WriteFile(path, []byte(tt.contents), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = Open(path)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v; want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	tests := []struct {
+		password string
+		want     float64
+	}{
+		{"", 0},
+		{"a", math.Log2(26)},
+		{"aaaa", math.Log2(26) + 3},
+		{"abcd", math.Log2(26) + 3},
+		{"azaz", 4 * math.Log2(26)},
+		{"aZ1!", 4 * math.Log2(26+26+10+33)},
+		{"1234", math.Log2(10) + 3},
+	}
+
+	for _, tt := range tests {
+		got := Entropy(tt.password)
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("got %f for %q; want %f", got, tt.password, tt.want)
+		}
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	policy := &Policy{MinEntropy: 50, Breached: openCorpus(t, "Tr0ub4dor&3-horse")}
+
+	tests := []struct {
+		name     string
+		password string
+		reason   string
+	}{
+		{"strong", "x8#Lq2!vZr9@kW", ""},
+		{"name", "Alice-x8#Lq2!vZr9", "must not contain your name or email address"},
+		{"email local part", "x8#Lq2!alice.smith", "must not contain your name or email address"},
+		{"weak", "aaaaaaaaaaaa", "is too easy to guess"},
+		{"breached", "Tr0ub4dor&3-horse", "has appeared in a data breach"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, err := policy.Check(tt.password, "Alice Smith", "alice.smith@example.com")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.HasPrefix(reason, tt.reason) || (tt.reason == "") != (reason == "") {
+				t.Errorf("got reason %q; want %q", reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestPolicyCheckShortPersonalParts(t *testing.T) {
+	// Parts shorter than minPersonalLength, as well as the domain, are allowed.
+	policy := &Policy{}
+
+	reason, err := policy.Check("jo-example-password", "Jo", "jo@example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reason != "" {
+		t.Errorf("got reason %q; want none", reason)
+	}
+}
@@ -0,0 +1,74 @@
+package passwords
+
+import (
+	"fmt"
+	"strings"
+)
+
+// minPersonalLength is the length from which a part of the name or email address of
+// the user is searched for in their password, shorter ones matching by chance.
+const minPersonalLength = 3
+
+// Policy holds the rules passwords must follow, beyond their length.
+type Policy struct {
+	// MinEntropy is the minimum estimated strength of passwords in bits, zero to
+	// accept any.
+	MinEntropy float64
+	// Breached holds the passwords known from data breaches, nil to skip screening.
+	Breached *Corpus
+}
+
+// Check returns the reason why the password doesn't follow the policy, or an empty
+// string if it does. Personal holds the name and email address of the user, which the
+// password must not contain.
+func (p *Policy) Check(password string, personal ...string) (string, error) {
+	lower := strings.ToLower(password)
+
+	for _, value := range personal {
+		for _, part := range personalParts(value) {
+			if strings.Contains(lower, part) {
+				return "must not contain your name or email address", nil
+			}
+		}
+	}
+
+	if entropy := Entropy(password); entropy < p.MinEntropy {
+		return fmt.Sprintf("is too easy to guess, use a longer password with a mix of letters, digits and symbols (strength %.0f of %.0f)", entropy, p.MinEntropy), nil
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return "", err
+		}
+		if breached {
+			return "has appeared in a data breach, please choose another one", nil
+		}
+	}
+
+	return "", nil
+}
+
+// personalParts splits a name or an email address into the lowercase parts to search
+// for in passwords: the whole value, and the words of the name or of the local part of
+// the email address. Domains are left out, as they are shared with other users.
+func personalParts(value string) []string {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	parts := []string{value}
+	if local, _, found := strings.Cut(value, "@"); found {
+		value = local
+		parts = append(parts, local)
+	}
+	parts = append(parts, strings.FieldsFunc(value, func(r rune) bool {
+		return strings.ContainsRune(" .-_+@'", r)
+	})...)
+
+	var long []string
+	for _, part := range parts {
+		if len(part) >= minPersonalLength {
+			long = append(long, part)
+		}
+	}
+	return long
+}
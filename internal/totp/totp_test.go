@@ -0,0 +1,100 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the base-32 encoding of the HMAC-SHA1 key of the RFC 6238 test vectors,
+// the ASCII string "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// The RFC 6238 vectors have 8 digits, of which the codes are the last 6.
+	tests := []struct {
+		time int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(tt.time, 0)))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if code != tt.code {
+			t.Errorf("got code %q at %d; want %q", code, tt.time, tt.code)
+		}
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	_, err := Code("not base-32!", 1)
+	if err == nil {
+		t.Error("got no error for an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		ok     bool
+		step   int64
+	}{
+		{"current step", rfcSecret, "050471", true, step},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "050471", true, step},
+		{"previous step", rfcSecret, mustCode(t, step-1), true, step - 1},
+		{"next step", rfcSecret, mustCode(t, step+1), true, step + 1},
+		{"outside the skew", rfcSecret, mustCode(t, step-2), false, 0},
+		{"wrong code", rfcSecret, "123456", false, 0},
+		{"wrong length", rfcSecret, "94287082", false, 0},
+		{"invalid secret", "not base-32!", "050471", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Validate(tt.secret, tt.code, now, 1)
+			if ok != tt.ok || got != tt.step {
+				t.Errorf("got (%d, %t); want (%d, %t)", got, ok, tt.step, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 160 bits encode to 32 base-32 characters.
+	if len(secret) != 32 {
+		t.Errorf("got secret of length %d; want 32", len(secret))
+	}
+
+	_, err = Code(secret, 1)
+	if err != nil {
+		t.Errorf("got error %v for a generated secret", err)
+	}
+}
+
+func mustCode(t *testing.T, step int64) string {
+	t.Helper()
+
+	code, err := Code(rfcSecret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
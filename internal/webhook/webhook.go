@@ -0,0 +1,163 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned when the target URL of a webhook resolves to an
+// address that webhooks must not be delivered to.
+var ErrForbiddenAddress = errors.New("webhook: target address is not allowed")
+
+// reservedPrefixes holds the special-purpose networks which aren't covered by the
+// netip.Addr methods used in PublicAddr.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// PublicAddr reports whether webhooks may be delivered to the IP address. Loopback,
+// link-local, private and other special-purpose addresses are rejected, so that
+// webhooks can't be used to reach the network the API runs in.
+func PublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Sender is a struct which contains the HTTP client used to deliver webhook
+// payloads to the subscribed target URLs.
+type Sender struct {
+	client *http.Client
+}
+
+// New returns a new Sender instance which gives up on a delivery after the timeout,
+// and only connects to public addresses.
+func New(timeout time.Duration) Sender {
+	return newSender(timeout, PublicAddr)
+}
+
+// newSender returns a Sender which only connects to the addresses allowed by the
+// allow function. The check is made on the address the target host resolved to, just
+// before connecting, so that a host can't pass validation then resolve to an internal
+// address at delivery time.
+func newSender(timeout time.Duration, allow func(netip.Addr) bool) Sender {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !allow(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+			}
+			return nil
+		},
+	}
+
+	return Sender{
+		client: &http.Client{
+			Timeout: timeout,
+			// Connect to the targets directly rather than through a proxy, as the
+			// addresses checked by the dialer would be those of the proxy.
+			Transport: &http.Transport{
+				DialContext:           dialer.DialContext,
+				ForceAttemptHTTP2:     true,
+				MaxIdleConns:          100,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: time.Second,
+			},
+			// Never follow redirects, a subscriber must register the final URL.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Send signs the payload with the secret and POSTs it to the target URL. It returns
+// the response status code, and an error if the request failed or the subscriber did
+// not respond with a 2xx status code.
+func (s Sender) Send(url, secret, event string, deliveryID int64, payload []byte) (int, error) {
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Greenlight-Webhooks")
+	req.Header.Set("Greenlight-Event", event)
+	req.Header.Set("Greenlight-Delivery", strconv.FormatInt(deliveryID, 10))
+	req.Header.Set("Greenlight-Signature", fmt.Sprintf("t=%d,v1=%s", timestamp, Sign(secret, timestamp, payload)))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// Drain a bounded amount of the body so that the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected response status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of the timestamp and payload joined by a
+// dot, keyed with the webhook secret. Subscribers recompute it to verify that the
+// payload came from us and reject stale timestamps to prevent replays.
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns how long to wait before retrying a delivery which has failed
+// the given number of attempts. The delay doubles with every attempt starting at
+// 30 seconds, and is capped at 6 hours.
+func Backoff(attempts int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= 6*time.Hour {
+			return 6 * time.Hour
+		}
+	}
+	return delay
+}
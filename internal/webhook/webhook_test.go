@@ -0,0 +1,191 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func allowAll(netip.Addr) bool { return true }
+
+func TestSend(t *testing.T) {
+	payload := []byte(`{"id":42,"event":"movie.created","data":{"movie":{"id":1}}}`)
+	secret := "0123456789abcdef"
+
+	var received *http.Request
+	var body []byte
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	status, err := newSender(5*time.Second, allowAll).Send(receiver.URL, secret, "movie.created", 42, payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status != http.StatusNoContent {
+		t.Errorf("got status %d; want %d", status, http.StatusNoContent)
+	}
+
+	if received.Method != http.MethodPost {
+		t.Errorf("got method %s; want POST", received.Method)
+	}
+	if string(body) != string(payload) {
+		t.Errorf("got body %q; want %q", body, payload)
+	}
+	if got := received.Header.Get("Greenlight-Event"); got != "movie.created" {
+		t.Errorf("got event header %q; want %q", got, "movie.created")
+	}
+	if got := received.Header.Get("Greenlight-Delivery"); got != "42" {
+		t.Errorf("got delivery header %q; want %q", got, "42")
+	}
+
+	// Verify the signature the way a subscriber would.
+	var timestamp int64
+	var signature string
+	for _, part := range strings.Split(received.Header.Get("Greenlight-Signature"), ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signature = value
+		}
+	}
+
+	if age := time.Since(time.Unix(timestamp, 0)); age < 0 || age > time.Minute {
+		t.Errorf("got signature timestamp %d, %s old", timestamp, age)
+	}
+	if want := Sign(secret, timestamp, body); signature != want {
+		t.Errorf("got signature %q; want %q", signature, want)
+	}
+}
+
+func TestSendUnexpectedStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+	}{
+		{"server error", http.StatusInternalServerError},
+		{"client error", http.StatusGone},
+		{"redirect", http.StatusFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.status == http.StatusFound {
+					w.Header().Set("Location", "/elsewhere")
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer receiver.Close()
+
+			status, err := newSender(5*time.Second, allowAll).Send(receiver.URL, "0123456789abcdef", "movie.deleted", 1, []byte(`{}`))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if status != tt.status {
+				t.Errorf("got status %d; want %d", status, tt.status)
+			}
+		})
+	}
+}
+
+func TestSendTimeout(t *testing.T) {
+	done := make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer receiver.Close()
+	defer close(done)
+
+	_, err := newSender(100*time.Millisecond, allowAll).Send(receiver.URL, "0123456789abcdef", "movie.updated", 1, []byte(`{}`))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestSendForbiddenAddress(t *testing.T) {
+	called := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer receiver.Close()
+
+	// The receiver listens on a loopback address, which the default sender refuses
+	// to connect to.
+	_, err := New(5*time.Second).Send(receiver.URL, "0123456789abcdef", "movie.created", 1, []byte(`{}`))
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("got error %v; want %v", err, ErrForbiddenAddress)
+	}
+	if called {
+		t.Error("the receiver was called")
+	}
+}
+
+func TestPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:93.184.216.34", true},
+		{"64:ff9b::a00:1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := PublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{5, 8 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour},
+		{100, 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.attempts), func(t *testing.T) {
+			if got := Backoff(tt.attempts); got != tt.want {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
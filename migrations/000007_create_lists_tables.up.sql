@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS lists
+(
+    id          bigserial PRIMARY KEY,
+    created_at  timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id     bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    name        text                        NOT NULL,
+    description text                        NOT NULL DEFAULT '',
+    visibility  text                        NOT NULL DEFAULT 'private',
+    share_token text UNIQUE                 NOT NULL,
+    version     integer                     NOT NULL DEFAULT 1
+);
+
+ALTER TABLE lists
+    ADD CONSTRAINT lists_visibility_check CHECK ( visibility IN ('private', 'unlisted', 'public') );
+
+CREATE INDEX IF NOT EXISTS lists_user_id_idx ON lists (user_id);
+
+CREATE TABLE IF NOT EXISTS list_items
+(
+    list_id  bigint                      NOT NULL REFERENCES lists ON DELETE CASCADE,
+    movie_id bigint                      NOT NULL REFERENCES movies ON DELETE CASCADE,
+    position integer                     NOT NULL,
+    notes    text                        NOT NULL DEFAULT '',
+    added_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (list_id, movie_id)
+);
@@ -0,0 +1,5 @@
+DELETE FROM permissions WHERE code = 'stats:refresh';
+DROP MATERIALIZED VIEW IF EXISTS movie_stats_weekly;
+DROP MATERIALIZED VIEW IF EXISTS movie_stats_years;
+DROP MATERIALIZED VIEW IF EXISTS movie_stats_genres;
+DROP MATERIALIZED VIEW IF EXISTS movie_stats_summary;
\ No newline at end of file
@@ -0,0 +1,37 @@
+CREATE MATERIALIZED VIEW IF NOT EXISTS movie_stats_summary AS
+SELECT true                                                                    AS singleton,
+       count(*)                                                                AS total_movies,
+       COALESCE(percentile_disc(0.25) WITHIN GROUP (ORDER BY runtime), 0)     AS runtime_p25,
+       COALESCE(percentile_disc(0.50) WITHIN GROUP (ORDER BY runtime), 0)     AS runtime_p50,
+       COALESCE(percentile_disc(0.75) WITHIN GROUP (ORDER BY runtime), 0)     AS runtime_p75,
+       COALESCE(percentile_disc(0.90) WITHIN GROUP (ORDER BY runtime), 0)     AS runtime_p90,
+       COALESCE(percentile_disc(0.99) WITHIN GROUP (ORDER BY runtime), 0)     AS runtime_p99,
+       NOW()                                                                   AS refreshed_at
+FROM movies;
+
+CREATE UNIQUE INDEX IF NOT EXISTS movie_stats_summary_singleton_idx ON movie_stats_summary (singleton);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS movie_stats_genres AS
+SELECT genre, count(*) AS total
+FROM movies, unnest(genres) AS genre
+GROUP BY genre;
+
+CREATE UNIQUE INDEX IF NOT EXISTS movie_stats_genres_genre_idx ON movie_stats_genres (genre);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS movie_stats_years AS
+SELECT year, count(*) AS total
+FROM movies
+GROUP BY year;
+
+CREATE UNIQUE INDEX IF NOT EXISTS movie_stats_years_year_idx ON movie_stats_years (year);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS movie_stats_weekly AS
+SELECT date_trunc('week', created_at) AS week, count(*) AS total
+FROM movies
+GROUP BY week;
+
+CREATE UNIQUE INDEX IF NOT EXISTS movie_stats_weekly_week_idx ON movie_stats_weekly (week);
+
+-- Add the permission for manually refreshing the statistics.
+INSERT INTO permissions(code)
+VALUES ('stats:refresh');
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS webhooks
+(
+    id         bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id    bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    url        text                        NOT NULL,
+    events     text[]                      NOT NULL,
+    secret     text                        NOT NULL,
+    active     boolean                     NOT NULL DEFAULT true,
+    version    integer                     NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS webhooks_events_idx ON webhooks USING GIN (events);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id              bigserial PRIMARY KEY,
+    created_at      timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    webhook_id      bigint                      NOT NULL REFERENCES webhooks ON DELETE CASCADE,
+    event           text                        NOT NULL,
+    payload         jsonb                       NOT NULL,
+    status          text                        NOT NULL DEFAULT 'pending',
+    attempts        integer                     NOT NULL DEFAULT 0,
+    next_attempt_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_attempt_at timestamp(0) with time zone,
+    response_status integer                     NOT NULL DEFAULT 0,
+    last_error      text                        NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id);
+
+-- Add the permission for managing webhook subscriptions.
+INSERT INTO permissions(code)
+VALUES ('webhooks:write');
@@ -0,0 +1,46 @@
+CREATE TABLE IF NOT EXISTS movie_events
+(
+    id         bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    event      text                        NOT NULL,
+    movie_id   bigint                      NOT NULL,
+    movie      jsonb
+);
+
+-- Record every change to the movies table, and notify the listening API instances
+-- of the new event ID along with the ID of the changed movie, as "event_id,movie_id".
+--
+-- Readers resume from the last event ID they have seen, so events must become visible
+-- in ID order. Sequence values are handed out in the order they are requested rather
+-- than the order their transactions commit in, so a transaction-scoped advisory lock
+-- is taken before recording the event: concurrent writers wait for it until the
+-- transaction holding it commits or rolls back, and only then get the next ID. This
+-- serializes the writes to the movies table, which are rare next to the reads.
+CREATE OR REPLACE FUNCTION record_movie_event() RETURNS trigger AS
+$$
+DECLARE
+    event_id bigint;
+    changed  bigint;
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtext('movie_events'));
+
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO movie_events (event, movie_id)
+        VALUES ('movie.deleted', OLD.id)
+        RETURNING id, movie_id INTO event_id, changed;
+    ELSE
+        INSERT INTO movie_events (event, movie_id, movie)
+        VALUES (CASE TG_OP WHEN 'INSERT' THEN 'movie.created' ELSE 'movie.updated' END, NEW.id, to_jsonb(NEW))
+        RETURNING id, movie_id INTO event_id, changed;
+    END IF;
+
+    PERFORM pg_notify('movie_events', event_id::text || ',' || changed::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER movies_record_event
+    AFTER INSERT OR UPDATE OR DELETE
+    ON movies
+    FOR EACH ROW
+EXECUTE FUNCTION record_movie_event();
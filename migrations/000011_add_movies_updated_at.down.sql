@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS movies_bump_catalog ON movies;
+DROP FUNCTION IF EXISTS bump_movies_catalog();
+DROP TABLE IF EXISTS movies_catalog;
+ALTER TABLE movies DROP COLUMN IF EXISTS updated_at;
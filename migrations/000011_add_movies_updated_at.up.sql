@@ -0,0 +1,33 @@
+ALTER TABLE movies
+    ADD COLUMN IF NOT EXISTS updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+
+UPDATE movies
+SET updated_at = created_at;
+
+-- A single row tracking changes to the whole catalog, so that responses listing
+-- movies can be validated even when one of them was deleted.
+CREATE TABLE IF NOT EXISTS movies_catalog
+(
+    id         boolean PRIMARY KEY         NOT NULL DEFAULT TRUE CHECK (id),
+    version    bigint                      NOT NULL DEFAULT 1,
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO movies_catalog DEFAULT VALUES
+ON CONFLICT DO NOTHING;
+
+CREATE OR REPLACE FUNCTION bump_movies_catalog() RETURNS trigger AS
+$$
+BEGIN
+    UPDATE movies_catalog
+    SET version    = version + 1,
+        updated_at = NOW();
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER movies_bump_catalog
+    AFTER INSERT OR UPDATE OR DELETE
+    ON movies
+    FOR EACH STATEMENT
+EXECUTE FUNCTION bump_movies_catalog();
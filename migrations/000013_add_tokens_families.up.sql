@@ -0,0 +1,7 @@
+-- Tokens issued from the same login share a family, so that they can be revoked
+-- together when a rotated refresh token is reused.
+ALTER TABLE tokens
+    ADD COLUMN IF NOT EXISTS family     text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS rotated_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS tokens_family_idx ON tokens (family) WHERE family <> '';
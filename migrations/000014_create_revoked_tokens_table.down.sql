@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS revoked_users_tokens;
+DROP TABLE IF EXISTS revoked_tokens;
+DROP FUNCTION IF EXISTS notify_token_revocation();
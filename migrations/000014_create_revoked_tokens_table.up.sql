@@ -0,0 +1,42 @@
+-- Holds the IDs of the signed authentication tokens revoked before they expire. Rows
+-- are only needed until the token expiry, after which the token is rejected anyway.
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti    text PRIMARY KEY,
+    expiry timestamp(0) with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS revoked_tokens_expiry_idx ON revoked_tokens (expiry);
+
+-- Holds the users whose signed authentication tokens issued up to revoked_before are
+-- all revoked, such as when they are logged out everywhere or deactivated. As for the
+-- revoked tokens, rows are only needed until the last of those tokens expires. There
+-- is no foreign key, so that the tokens of deleted users stay revoked.
+CREATE TABLE IF NOT EXISTS revoked_users_tokens (
+    user_id        bigint PRIMARY KEY,
+    revoked_before timestamp with time zone    NOT NULL,
+    expiry         timestamp(0) with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS revoked_users_tokens_expiry_idx ON revoked_users_tokens (expiry);
+
+-- Notify the listening API instances of new revocations, so that they reload them
+-- straight away rather than accepting the revoked tokens until their next sync.
+CREATE OR REPLACE FUNCTION notify_token_revocation() RETURNS trigger AS
+$$
+BEGIN
+    PERFORM pg_notify('token_revocations', '');
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER revoked_tokens_notify
+    AFTER INSERT OR UPDATE
+    ON revoked_tokens
+    FOR EACH STATEMENT
+EXECUTE FUNCTION notify_token_revocation();
+
+CREATE TRIGGER revoked_users_tokens_notify
+    AFTER INSERT OR UPDATE
+    ON revoked_users_tokens
+    FOR EACH STATEMENT
+EXECUTE FUNCTION notify_token_revocation();
@@ -0,0 +1,3 @@
+ALTER TABLE tokens DROP COLUMN IF EXISTS failed_attempts;
+DROP TABLE IF EXISTS two_factor_recovery_codes;
+DROP TABLE IF EXISTS users_two_factor;
@@ -0,0 +1,25 @@
+-- The TOTP secret is encrypted by the application. Enrolment is pending until the
+-- user confirms it with a first code.
+CREATE TABLE IF NOT EXISTS users_two_factor
+(
+    user_id        bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    created_at     timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    secret         bytea                       NOT NULL,
+    confirmed_at   timestamp(0) with time zone,
+    last_used_step bigint                      NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS two_factor_recovery_codes
+(
+    id      bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    hash    bytea  NOT NULL,
+    used_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS two_factor_recovery_codes_user_id_idx ON two_factor_recovery_codes (user_id);
+
+-- Counts the invalid codes sent with a two-factor challenge token, which is deleted
+-- after a few of them.
+ALTER TABLE tokens
+    ADD COLUMN IF NOT EXISTS failed_attempts integer NOT NULL DEFAULT 0;
@@ -0,0 +1,40 @@
+CREATE TABLE IF NOT EXISTS oauth_clients
+(
+    id            bigserial PRIMARY KEY,
+    created_at    timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id       bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    client_id     text                        NOT NULL UNIQUE,
+    secret_hash   bytea,
+    name          text                        NOT NULL,
+    redirect_uris text[]                      NOT NULL,
+    scopes        text[]                      NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS oauth_clients_user_id_idx ON oauth_clients (user_id);
+
+CREATE TABLE IF NOT EXISTS oauth_consents
+(
+    user_id    bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    client_id  bigint                      NOT NULL REFERENCES oauth_clients ON DELETE CASCADE,
+    scopes     text[]                      NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, client_id)
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes
+(
+    hash           bytea PRIMARY KEY,
+    client_id      bigint                      NOT NULL REFERENCES oauth_clients ON DELETE CASCADE,
+    user_id        bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    redirect_uri   text                        NOT NULL,
+    scopes         text[]                      NOT NULL,
+    code_challenge text                        NOT NULL,
+    expiry         timestamp(0) with time zone NOT NULL
+);
+
+-- Tokens issued to an OAuth client are restricted to the granted scopes. The columns
+-- are NULL for the tokens of the first-party clients.
+ALTER TABLE tokens
+    ADD COLUMN IF NOT EXISTS client_id bigint REFERENCES oauth_clients ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS scopes    text[];
@@ -0,0 +1,22 @@
+-- Pending logins with the external OpenID Connect provider, keyed by the hash of the
+-- state parameter sent to the provider.
+CREATE TABLE IF NOT EXISTS oidc_logins
+(
+    hash          bytea PRIMARY KEY,
+    nonce         text                        NOT NULL,
+    code_verifier text                        NOT NULL,
+    expiry        timestamp(0) with time zone NOT NULL
+);
+
+-- The accounts of the users with the external provider, identified by the issuer and
+-- subject of their ID tokens.
+CREATE TABLE IF NOT EXISTS user_identities
+(
+    issuer     text                        NOT NULL,
+    subject    text                        NOT NULL,
+    user_id    bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities (user_id);
@@ -0,0 +1,11 @@
+-- Failed logins are tracked per account, by email address so that unknown addresses
+-- are throttled like registered ones, and per client IP address.
+CREATE TABLE IF NOT EXISTS login_failures
+(
+    kind           text                        NOT NULL,
+    key            text                        NOT NULL,
+    failures       integer                     NOT NULL,
+    last_failed_at timestamp(0) with time zone NOT NULL,
+    locked_until   timestamp(0) with time zone,
+    PRIMARY KEY (kind, key)
+);
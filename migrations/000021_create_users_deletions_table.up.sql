@@ -0,0 +1,10 @@
+-- Users who asked for their account to be deleted, which happens once the grace
+-- period has passed unless they cancel it.
+CREATE TABLE IF NOT EXISTS users_deletions
+(
+    user_id      bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    requested_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    delete_at    timestamp(0) with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS users_deletions_delete_at_idx ON users_deletions (delete_at);
@@ -0,0 +1,8 @@
+-- Deactivated users can't log in or use their existing tokens and API keys, until an
+-- administrator reactivates them.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS deactivated boolean NOT NULL DEFAULT false;
+
+-- Add the permission for administering users.
+INSERT INTO permissions(code)
+VALUES ('users:admin');
@@ -0,0 +1,39 @@
+-- Roles bundle permissions, which users are granted along with their direct ones.
+CREATE TABLE IF NOT EXISTS roles
+(
+    id          bigserial PRIMARY KEY,
+    created_at  timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name        text UNIQUE                 NOT NULL,
+    description text                        NOT NULL DEFAULT '',
+    version     integer                     NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions
+(
+    role_id       bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS users_roles
+(
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS users_roles_role_id_idx ON users_roles (role_id);
+
+-- Add the default roles.
+INSERT INTO roles(name, description)
+VALUES ('viewer', 'Browse the movies.'),
+       ('editor', 'Browse and edit the movies.'),
+       ('admin', 'Every permission, including administering users.');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles,
+     permissions
+WHERE roles.name = 'viewer' AND permissions.code = 'movies:read'
+   OR roles.name = 'editor' AND permissions.code IN ('movies:read', 'movies:write', 'stats:refresh')
+   OR roles.name = 'admin';
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS roles_permissions_notify_change ON roles_permissions;
+DROP TRIGGER IF EXISTS users_roles_notify_change ON users_roles;
+DROP TRIGGER IF EXISTS users_permissions_notify_change ON users_permissions;
+DROP FUNCTION IF EXISTS notify_permission_change();
@@ -0,0 +1,40 @@
+-- Notify the listening API instances of the users whose permissions changed, so that
+-- they can drop them from their permission caches. An empty payload stands for every
+-- user, when the permissions of a role change.
+CREATE OR REPLACE FUNCTION notify_permission_change() RETURNS trigger AS
+$$
+DECLARE
+    changed record;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD;
+    ELSE
+        changed := NEW;
+    END IF;
+
+    IF TG_TABLE_NAME = 'roles_permissions' THEN
+        PERFORM pg_notify('permission_changes', '');
+    ELSE
+        PERFORM pg_notify('permission_changes', changed.user_id::text);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_permissions_notify_change
+    AFTER INSERT OR UPDATE OR DELETE
+    ON users_permissions
+    FOR EACH ROW
+EXECUTE FUNCTION notify_permission_change();
+
+CREATE TRIGGER users_roles_notify_change
+    AFTER INSERT OR UPDATE OR DELETE
+    ON users_roles
+    FOR EACH ROW
+EXECUTE FUNCTION notify_permission_change();
+
+CREATE TRIGGER roles_permissions_notify_change
+    AFTER INSERT OR UPDATE OR DELETE
+    ON roles_permissions
+    FOR EACH ROW
+EXECUTE FUNCTION notify_permission_change();